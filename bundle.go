@@ -0,0 +1,200 @@
+package toast
+
+import (
+	"fmt"
+	"go/build"
+)
+
+// bundler adds to a file the declarations of the types of other packages that
+// it refers to, so that its output is self-contained. See WithBundle.
+type bundler struct {
+	f *File
+	// pkgs are the packages parsed, by import path, or nil for those that
+	// cannot be bundled.
+	pkgs map[string]*File
+	// names are the names of the bundled types, by import path and name, or
+	// empty for those that cannot be bundled.
+	names map[string]string
+	// prefixes are the prefixes of the names of bundled types, by import path.
+	prefixes map[string]string
+	code     []Type
+}
+
+// bundleImports adds the declarations of the types of packages in the module or
+// GOPATH that the code of f refers to, and of those they refer to in turn.
+// Each is named after its package, e.g. meta_Object for meta.Object, and the
+// references to it are rewritten.
+func (f *File) bundleImports() {
+	b := &bundler{
+		f:        f,
+		pkgs:     make(map[string]*File),
+		names:    make(map[string]string),
+		prefixes: make(map[string]string),
+	}
+	for _, t := range f.Code {
+		b.rewrite(t, "", f.Imports, f.srcDir)
+	}
+	f.Code = append(f.Code, b.code...)
+}
+
+// rewrite replaces the references in t to types that can be bundled. pkgPath
+// is the import path of the package t is declared in, or empty for the file
+// being bundled into, and imports and srcDir are those of its file.
+func (b *bundler) rewrite(t Type, pkgPath string, imports map[string]Import, srcDir string) {
+	for _, ref := range t.GetTypeRefs() {
+		ref.Walk(func(r *TypeRef) bool {
+			if r.Kind != RefNamed || r.IsBasic() {
+				return true
+			}
+			path := pkgPath
+			if r.Package != "" {
+				imp, ok := imports[r.Package]
+				if !ok {
+					return true
+				}
+				path = imp.GetOldPath()
+			} else if pkgPath == "" || b.pkgs[pkgPath].decl(r.Name) == nil {
+				return true
+			}
+			var name string
+			if r.WellKnown == "" {
+				name = b.include(path, r.Name, srcDir)
+			}
+			if name != "" {
+				r.Package, r.Path, r.Name = "", path, name
+			} else if r.Package != "" && pkgPath != "" {
+				// A bundled type refers to a type that is not bundled,
+				// such as one of the standard library.
+				r.Package = b.f.importName(imports[r.Package], r.Package)
+			}
+			return true
+		})
+	}
+	if st, ok := t.(*StructType); ok {
+		renameEmbedded(st)
+	}
+}
+
+// importName returns the name that the package of imp is imported with in f,
+// adding imp as name if it is not imported yet. A package with the same name
+// as another one imported is given an alias, as in v12 for a second v1.
+func (f *File) importName(imp Import, name string) string {
+	for n, i := range f.Imports {
+		if i.GetOldPath() == imp.GetOldPath() {
+			return n
+		}
+	}
+	alias := name
+	for n := 2; ; n++ {
+		if _, ok := f.Imports[alias]; !ok {
+			break
+		}
+		alias = fmt.Sprintf("%s%d", name, n)
+	}
+	if alias != name {
+		imp.Name = alias
+	}
+	f.Imports[alias] = imp
+	return alias
+}
+
+// renameEmbedded names the embedded fields of st after their types, which
+// may have been renamed.
+func renameEmbedded(st *StructType) {
+	for _, field := range st.Fields {
+		switch ft := field.Type.(type) {
+		case *PlainType:
+			if field.Embedded {
+				ft.Name = ft.Type.Name
+			}
+		case *StructType:
+			renameEmbedded(ft)
+		}
+	}
+}
+
+// include bundles the type with the given name in the package with the given
+// import path, and returns its bundled name, or nothing if it cannot be
+// bundled.
+func (b *bundler) include(path, name, srcDir string) string {
+	key := path + "." + name
+	if bundled, ok := b.names[key]; ok {
+		return bundled
+	}
+	b.names[key] = ""
+	pkg := b.load(path, srcDir)
+	if pkg == nil {
+		return ""
+	}
+	decl := pkg.decl(name)
+	if decl == nil {
+		b.f.Diagnostics = append(b.f.Diagnostics, &Diagnostic{
+			Severity: SeverityWarning,
+			Code:     CodeUnbundled,
+			Message:  fmt.Sprintf("%s.%s: type not found", path, name),
+		})
+		return ""
+	}
+	bundled := b.prefix(path, pkg.pkgName) + "_" + name
+	b.names[key] = bundled
+
+	t := cloneType(decl)
+	t.setName(bundled)
+	b.rewrite(t, path, pkg.Imports, pkg.srcDir)
+	b.code = append(b.code, t)
+	return bundled
+}
+
+// load parses the package with the given import path, as found from srcDir,
+// unless it is in the standard library.
+func (b *bundler) load(path, srcDir string) *File {
+	if pkg, ok := b.pkgs[path]; ok {
+		return pkg
+	}
+	b.pkgs[path] = nil
+	// The go command resolves module imports from its working directory.
+	ctxt := build.Default
+	ctxt.Dir = srcDir
+	bp, err := ctxt.Import(path, srcDir, build.FindOnly)
+	if err == nil && bp.Goroot {
+		return nil
+	}
+	var pkg *File
+	if err == nil {
+		pkg, err = NewPackage(bp.Dir, WithLenient())
+	}
+	if err != nil {
+		b.f.Diagnostics = append(b.f.Diagnostics, &Diagnostic{
+			Severity: SeverityWarning,
+			Code:     CodeUnbundled,
+			Message:  fmt.Sprintf("%s: %s", path, err),
+		})
+		return nil
+	}
+	b.pkgs[path] = pkg
+	return pkg
+}
+
+// prefix returns the prefix of the names of the types bundled from the
+// package with the given import path, which is its name, numbered if another
+// package with the same name was bundled.
+func (b *bundler) prefix(path, pkgName string) string {
+	if prefix, ok := b.prefixes[path]; ok {
+		return prefix
+	}
+	prefix := pkgName
+	for i := 2; b.hasPrefix(prefix); i++ {
+		prefix = fmt.Sprintf("%s%d", pkgName, i)
+	}
+	b.prefixes[path] = prefix
+	return prefix
+}
+
+func (b *bundler) hasPrefix(prefix string) bool {
+	for _, p := range b.prefixes {
+		if p == prefix {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,405 @@
+package toast
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Constraints are the rules that the value of a field or type must satisfy,
+// from the validate tag of go-playground/validator or from kubebuilder
+// markers. They follow JSON Schema, so that any schema emitter can render
+// them: bounds apply to the value of a number, to the length in runes of a
+// string, and to the number of elements of a slice, array or map.
+type Constraints struct {
+	Required bool `json:"required,omitempty"`
+	// OmitEmpty is set by the omitempty rule of validator, which skips the
+	// other rules for an empty value: the zero value, or nil for a pointer,
+	// slice or map.
+	OmitEmpty        bool     `json:"omit_empty,omitempty"`
+	Optional         bool     `json:"optional,omitempty"`
+	Minimum          *float64 `json:"minimum,omitempty"`
+	Maximum          *float64 `json:"maximum,omitempty"`
+	ExclusiveMinimum bool     `json:"exclusive_minimum,omitempty"`
+	ExclusiveMaximum bool     `json:"exclusive_maximum,omitempty"`
+	MinLength        *int     `json:"min_length,omitempty"`
+	MaxLength        *int     `json:"max_length,omitempty"`
+	MinItems         *int     `json:"min_items,omitempty"`
+	MaxItems         *int     `json:"max_items,omitempty"`
+	// Enum are the values allowed, as strings for a string, as float64 for
+	// a number and as bools for a bool.
+	Enum []interface{} `json:"enum,omitempty"`
+	// Format is the name of a format that a string must have, such as
+	// "email", which Patterns check.
+	Format   string   `json:"format,omitempty"`
+	Patterns []string `json:"patterns,omitempty"`
+	// Default is the default value, as decoded from JSON.
+	Default interface{} `json:"default,omitempty"`
+
+	// empty is the CUE literal of the empty value of OmitEmpty.
+	empty string
+}
+
+// validateFormats are the patterns of the string formats of validator.
+var validateFormats = map[string]string{
+	"email":       `^[^@\s]+@[^@\s]+\.[^@\s]+$`,
+	"url":         `^[A-Za-z][A-Za-z0-9+.-]*://[^\s]+$`,
+	"uri":         `^[A-Za-z][A-Za-z0-9+.-]*:[^\s]*$`,
+	"uuid":        `^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`,
+	"hostname":    `^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?)*$`,
+	"ipv4":        `^([0-9]{1,3}\.){3}[0-9]{1,3}$`,
+	"alpha":       `^[A-Za-z]+$`,
+	"alphanum":    `^[A-Za-z0-9]+$`,
+	"numeric":     `^[-+]?[0-9]+(\.[0-9]+)?$`,
+	"hexadecimal": `^(0[xX])?[0-9a-fA-F]+$`,
+	"lowercase":   `^[^A-Z]*$`,
+	"uppercase":   `^[^a-z]*$`,
+}
+
+// valueKind is the kind of value that constraints apply to.
+type valueKind int
+
+const (
+	kindOther valueKind = iota
+	kindNumber
+	kindString
+	kindBool
+	kindItems
+)
+
+// constraintsFromTag returns the constraints given by the rules of a validate
+// tag for a value of the given kind, and the rules that cannot be translated.
+func constraintsFromTag(rules []string, kind valueKind) (*Constraints, []string) {
+	c := &Constraints{}
+	var unsupported []string
+	for i, rule := range rules {
+		name, param, _ := strings.Cut(rule, "=")
+		if !c.apply(name, param, kind) {
+			unsupported = append(unsupported, rule)
+		}
+		if name == "dive" {
+			// The rules that follow apply to the elements, which have no
+			// constraints of their own.
+			unsupported = append(unsupported, rules[i+1:]...)
+			break
+		}
+	}
+	return c, unsupported
+}
+
+// oneofValue matches a value of a oneof rule, which is quoted if it has
+// spaces, as in oneof='red green' blue.
+var oneofValue = regexp.MustCompile(`'[^']*'|\S+`)
+
+// oneofValues returns the values of a oneof rule, as validator parses them.
+func oneofValues(param string) []string {
+	values := oneofValue.FindAllString(param, -1)
+	for i, v := range values {
+		values[i] = strings.ReplaceAll(v, "'", "")
+	}
+	return values
+}
+
+// apply adds the constraint of a rule, reporting false if it cannot be
+// translated.
+func (c *Constraints) apply(name, param string, kind valueKind) bool {
+	switch name {
+	case "":
+		return true
+	case "omitempty":
+		c.OmitEmpty = true
+		return true
+	case "required":
+		c.Required = true
+		return true
+	case "min", "max", "len", "gt", "gte", "lt", "lte":
+		return c.bound(name, param, kind)
+	case "oneof":
+		for _, v := range oneofValues(param) {
+			switch kind {
+			case kindString:
+				c.Enum = append(c.Enum, v)
+			case kindNumber:
+				n, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					return false
+				}
+				c.Enum = append(c.Enum, n)
+			default:
+				return false
+			}
+		}
+		return true
+	case "startswith", "endswith", "contains":
+		if kind != kindString {
+			return false
+		}
+		pattern := regexp.QuoteMeta(param)
+		switch name {
+		case "startswith":
+			pattern = "^" + pattern
+		case "endswith":
+			pattern += "$"
+		}
+		c.Patterns = append(c.Patterns, pattern)
+		return true
+	}
+	if pattern, ok := validateFormats[name]; ok && kind == kindString {
+		c.Format = name
+		c.Patterns = append(c.Patterns, pattern)
+		return true
+	}
+	return false
+}
+
+// bound adds a bound on a value, its length or its number of elements.
+func (c *Constraints) bound(name, param string, kind valueKind) bool {
+	if kind == kindNumber {
+		n, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return false
+		}
+		switch name {
+		case "min", "gte", "gt":
+			c.Minimum, c.ExclusiveMinimum = &n, name == "gt"
+		case "max", "lte", "lt":
+			c.Maximum, c.ExclusiveMaximum = &n, name == "lt"
+		case "len":
+			c.Minimum, c.Maximum = &n, &n
+		}
+		return true
+	}
+	n, err := strconv.Atoi(param)
+	if err != nil {
+		return false
+	}
+	min, max := &c.MinLength, &c.MaxLength
+	switch kind {
+	case kindString:
+	case kindItems:
+		min, max = &c.MinItems, &c.MaxItems
+	default:
+		return false
+	}
+	switch name {
+	case "min", "gte":
+		*min = &n
+	case "gt":
+		n++
+		*min = &n
+	case "max", "lte":
+		*max = &n
+	case "lt":
+		n--
+		*max = &n
+	case "len":
+		*min, *max = &n, &n
+	}
+	return true
+}
+
+// resolveConstraints sets the constraints of the struct fields in code from
+// their validate tags and markers, and reports the rules that cannot be
+// translated.
+func (f *File) resolveConstraints(code []Type) {
+	for _, t := range code {
+		st, ok := t.(*StructType)
+		if !ok {
+			continue
+		}
+		for _, field := range st.Fields {
+			if nested, ok := field.Type.(*StructType); ok {
+				f.resolveConstraints([]Type{nested})
+			}
+			kind := f.valueKind(field.Type)
+			c := &Constraints{}
+			if tag := field.tag("validate"); tag != nil {
+				var unsupported []string
+				c, unsupported = constraintsFromTag(append([]string{tag.Name}, tag.Options...), kind)
+				for _, rule := range unsupported {
+					f.unsupportedRule(field, st.Name+"."+field.GetName()+": validate rule "+rule)
+				}
+			}
+			for _, marker := range c.applyMarkers(field.GetMarkers(), kind) {
+				f.unsupportedRule(field, st.Name+"."+field.GetName()+": marker +"+marker)
+			}
+			if _, ok := field.GetDirectives()["optional"]; ok {
+				c.Optional = true
+			}
+			if c.OmitEmpty {
+				c.empty = emptyValue(field.Type, kind)
+			}
+			if !c.isZero() {
+				field.Constraints = c
+			}
+		}
+	}
+}
+
+func (f *File) unsupportedRule(t Type, rule string) {
+	f.Diagnostics = append(f.Diagnostics, &Diagnostic{
+		Severity: SeverityWarning,
+		Code:     CodeUnsupportedRule,
+		Message:  rule + " is not supported",
+		Pos:      t.GetPos(),
+	})
+}
+
+func (c *Constraints) isZero() bool {
+	return reflect.DeepEqual(c, &Constraints{})
+}
+
+// emptyValue returns the CUE literal of the value of a field of type t and
+// of the given kind that validator treats as empty: null for a pointer, slice
+// or map, as encoding/json renders nil, and the zero value otherwise. It is
+// empty for arrays and other kinds.
+func emptyValue(t Type, kind valueKind) string {
+	if pt, ok := t.(*PlainType); ok && (pt.Type.Pointer || pt.Type.Kind == RefPointer) {
+		return "null"
+	}
+	switch kind {
+	case kindString:
+		return `""`
+	case kindNumber:
+		return "0"
+	case kindBool:
+		return "false"
+	case kindItems:
+		// An array is never nil, and its zero value has no literal.
+		if at, ok := t.(*ArrayType); ok && (at.Length > 0 || at.LengthExpr != "") {
+			return ""
+		}
+		if pt, ok := t.(*PlainType); ok && pt.Type.Kind == RefArray {
+			return ""
+		}
+		return "null"
+	}
+	return ""
+}
+
+// valueKind returns the kind of value of a field of type t, looking up the
+// declarations of the file for named types.
+func (f *File) valueKind(t Type) valueKind {
+	switch tt := t.(type) {
+	case *ArrayType, *MapType:
+		return kindItems
+	case *EnumType:
+		if tt.Type != nil {
+			return f.refKind(tt.Type, 0)
+		}
+		return kindString
+	case *PlainType:
+		return f.refKind(tt.Type, 0)
+	}
+	return kindOther
+}
+
+func (f *File) refKind(r *TypeRef, depth int) valueKind {
+	switch r.Kind {
+	case RefSlice, RefArray, RefMap:
+		return kindItems
+	case RefPointer:
+		return f.refKind(r.Elem, depth)
+	case RefNamed:
+	default:
+		return kindOther
+	}
+	switch {
+	case r.Name == "string" && r.IsBasic():
+		return kindString
+	case r.Name == "bool" && r.IsBasic():
+		return kindBool
+	case r.IsBasic():
+		return kindNumber
+	case r.Underlying != nil:
+		return f.refKind(r.Underlying, depth)
+	case r.Package == "" && depth < 8:
+		if decl := f.decl(r.Name); decl != nil {
+			if pt, ok := decl.(*PlainType); ok {
+				return f.refKind(pt.Type, depth+1)
+			}
+			return f.valueKind(decl)
+		}
+	}
+	return kindOther
+}
+
+// fmtConstraintsToCUE renders typ with the constraints c. isMap is set for a
+// map, whose elements are counted as fields.
+func fmtConstraintsToCUE(typ string, c *Constraints, isMap bool) string {
+	var values []string
+	for _, v := range c.Enum {
+		switch v := v.(type) {
+		case string:
+			values = append(values, strconv.Quote(v))
+		case float64:
+			values = append(values, strconv.FormatFloat(v, 'g', -1, 64))
+		case bool:
+			values = append(values, strconv.FormatBool(v))
+		}
+	}
+	parts := []string{typ}
+	if len(values) > 0 {
+		parts = []string{strings.Join(values, " | ")}
+	}
+	if c.Minimum != nil {
+		op := ">="
+		if c.ExclusiveMinimum {
+			op = ">"
+		}
+		parts = append(parts, op+strconv.FormatFloat(*c.Minimum, 'g', -1, 64))
+	}
+	if c.Maximum != nil {
+		op := "<="
+		if c.ExclusiveMaximum {
+			op = "<"
+		}
+		parts = append(parts, op+strconv.FormatFloat(*c.Maximum, 'g', -1, 64))
+	}
+	if c.MinLength != nil {
+		parts = append(parts, fmt.Sprintf("strings.MinRunes(%d)", *c.MinLength))
+	}
+	if c.MaxLength != nil {
+		parts = append(parts, fmt.Sprintf("strings.MaxRunes(%d)", *c.MaxLength))
+	}
+	min, max := "list.MinItems(%d)", "list.MaxItems(%d)"
+	if isMap {
+		min, max = "struct.MinFields(%d)", "struct.MaxFields(%d)"
+	}
+	if c.MinItems != nil {
+		parts = append(parts, fmt.Sprintf(min, *c.MinItems))
+	}
+	if c.MaxItems != nil {
+		parts = append(parts, fmt.Sprintf(max, *c.MaxItems))
+	}
+	for _, pattern := range c.Patterns {
+		parts = append(parts, "=~"+strconv.Quote(pattern))
+	}
+	if len(parts) > 1 {
+		switch {
+		case len(values) > 1:
+			// A disjunction binds looser than the constraints.
+			parts[0] = "(" + parts[0] + ")"
+		case len(values) == 0 && isMap && strings.HasPrefix(typ, "["):
+			// A map given as a field pattern must be a struct to be
+			// constrained.
+			parts[0] = "{" + typ + "}"
+		}
+	}
+	str := strings.Join(parts, " & ")
+	if c.empty != "" && str != typ {
+		// The other rules do not apply to the empty value.
+		if len(parts) > 1 {
+			str = "(" + str + ")"
+		}
+		str = c.empty + " | " + str
+	}
+	if c.Default != nil {
+		def, _ := json.Marshal(c.Default)
+		str = "*" + string(def) + " | " + str
+	}
+	return str
+}
@@ -0,0 +1,265 @@
+package toast
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// ConstsFromDecls evaluates the constants declared in decls, including those
+// defined in terms of iota or of other constants in decls, and converted to
+// types declared in decls. Constants whose values depend on anything else,
+// such as imported constants or function calls, are left out.
+func ConstsFromDecls(decls []ast.Decl) map[string]constant.Value {
+	types := constTypesFromDecls(decls)
+	consts := make(map[string]constant.Value)
+	for n := -1; n != len(consts); {
+		n = len(consts)
+		for _, decl := range decls {
+			if gd, ok := decl.(*ast.GenDecl); ok && gd.Tok == token.CONST {
+				evalConstDecl(gd, consts, types)
+			}
+		}
+	}
+	return consts
+}
+
+// constTypesFromDecls returns the basic type underlying each type declared in
+// decls that has one, such as float64 for "type R float64".
+func constTypesFromDecls(decls []ast.Decl) map[string]string {
+	specs := make(map[string]ast.Expr)
+	for _, decl := range decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			if ts, ok := spec.(*ast.TypeSpec); ok && ts.TypeParams == nil {
+				specs[ts.Name.Name] = ts.Type
+			}
+		}
+	}
+	types := make(map[string]string)
+	for name := range specs {
+		typ := name
+		for depth := 0; depth < 8; depth++ {
+			id, ok := specs[typ].(*ast.Ident)
+			if !ok {
+				break
+			}
+			typ = id.Name
+		}
+		if _, ok := specs[typ]; !ok && basicTypes[typ] {
+			types[name] = typ
+		}
+	}
+	return types
+}
+
+func evalConstDecl(decl *ast.GenDecl, consts map[string]constant.Value, types map[string]string) {
+	var values []ast.Expr
+	for iota, spec := range decl.Specs {
+		vs := spec.(*ast.ValueSpec)
+		if len(vs.Values) > 0 {
+			values = vs.Values
+		}
+		for i, name := range vs.Names {
+			if _, ok := consts[name.Name]; ok || i >= len(values) || name.Name == "_" {
+				continue
+			}
+			if v := evalConst(values[i], consts, types, iota); v.Kind() != constant.Unknown {
+				consts[name.Name] = v
+			}
+		}
+	}
+}
+
+// evalConst evaluates a constant expression, returning an Unknown value if it
+// cannot be evaluated. types holds the basic types underlying the declared
+// types that values can be converted to, as returned by constTypesFromDecls.
+func evalConst(expr ast.Expr, consts map[string]constant.Value, types map[string]string, iota int) constant.Value {
+	unknown := constant.MakeUnknown()
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		return constant.MakeFromLiteral(e.Value, e.Kind, 0)
+	case *ast.Ident:
+		switch e.Name {
+		case "iota":
+			return constant.MakeInt64(int64(iota))
+		case "true", "false":
+			return constant.MakeBool(e.Name == "true")
+		}
+		if v, ok := consts[e.Name]; ok {
+			return v
+		}
+		return unknown
+	case *ast.ParenExpr:
+		return evalConst(e.X, consts, types, iota)
+	case *ast.CallExpr:
+		// A conversion such as Color(iota) or int64(1). Calls of builtin
+		// functions, such as len("abc"), are not evaluated.
+		id, ok := e.Fun.(*ast.Ident)
+		if !ok || len(e.Args) != 1 {
+			return unknown
+		}
+		typ := id.Name
+		if underlying, ok := types[typ]; ok {
+			typ = underlying
+		} else if !basicTypes[typ] && typ != "complex128" {
+			return unknown
+		}
+		return convertConst(evalConst(e.Args[0], consts, types, iota), typ)
+	case *ast.UnaryExpr:
+		x := evalConst(e.X, consts, types, iota)
+		switch {
+		case e.Op == token.NOT && x.Kind() == constant.Bool,
+			(e.Op == token.ADD || e.Op == token.SUB) && isNumeric(x),
+			e.Op == token.XOR && x.Kind() == constant.Int:
+			return constant.UnaryOp(e.Op, x, 0)
+		}
+		return unknown
+	case *ast.BinaryExpr:
+		x, y := evalConst(e.X, consts, types, iota), evalConst(e.Y, consts, types, iota)
+		switch e.Op {
+		case token.SHL, token.SHR:
+			// An untyped float operand of a shift is converted to an
+			// integer, as in 1.0 << 3.
+			x, y = constant.ToInt(x), constant.ToInt(y)
+			s, ok := constant.Uint64Val(y)
+			if x.Kind() != constant.Int || y.Kind() != constant.Int || !ok {
+				return unknown
+			}
+			return constant.Shift(x, e.Op, uint(s))
+		case token.LAND, token.LOR:
+			if x.Kind() != constant.Bool || y.Kind() != constant.Bool {
+				return unknown
+			}
+			return constant.BinaryOp(x, e.Op, y)
+		case token.EQL, token.NEQ:
+			if !matchConst(x, y) {
+				return unknown
+			}
+			return constant.MakeBool(constant.Compare(x, e.Op, y))
+		case token.LSS, token.LEQ, token.GTR, token.GEQ:
+			if !matchConst(x, y) || x.Kind() == constant.Bool || x.Kind() == constant.Complex || y.Kind() == constant.Complex {
+				return unknown
+			}
+			return constant.MakeBool(constant.Compare(x, e.Op, y))
+		case token.ADD:
+			if !matchConst(x, y) || x.Kind() == constant.Bool {
+				return unknown
+			}
+			return constant.BinaryOp(x, e.Op, y)
+		case token.SUB, token.MUL:
+			if !isNumeric(x) || !isNumeric(y) {
+				return unknown
+			}
+			return constant.BinaryOp(x, e.Op, y)
+		case token.QUO:
+			if !isNumeric(x) || !isNumeric(y) || constant.Sign(y) == 0 {
+				return unknown
+			}
+			if x.Kind() == constant.Int && y.Kind() == constant.Int {
+				return constant.BinaryOp(x, token.QUO_ASSIGN, y)
+			}
+			return constant.BinaryOp(x, e.Op, y)
+		case token.REM, token.AND, token.OR, token.XOR, token.AND_NOT:
+			if x.Kind() != constant.Int || y.Kind() != constant.Int || e.Op == token.REM && constant.Sign(y) == 0 {
+				return unknown
+			}
+			return constant.BinaryOp(x, e.Op, y)
+		}
+	}
+	return unknown
+}
+
+// convertConst converts x to the basic type with the given name, returning an
+// Unknown value if it cannot be.
+func convertConst(x constant.Value, typ string) constant.Value {
+	unknown := constant.MakeUnknown()
+	switch {
+	case typ == "string":
+		switch x.Kind() {
+		case constant.String:
+			return x
+		case constant.Int:
+			if r, ok := constant.Int64Val(x); ok {
+				return constant.MakeString(string(rune(r)))
+			}
+		}
+		return unknown
+	case typ == "bool":
+		if x.Kind() != constant.Bool {
+			return unknown
+		}
+		return x
+	case !isNumeric(x):
+		return unknown
+	case strings.HasPrefix(typ, "float"):
+		return constant.ToFloat(x)
+	case strings.HasPrefix(typ, "complex"):
+		return constant.ToComplex(x)
+	}
+	return constant.ToInt(x)
+}
+
+func isNumeric(x constant.Value) bool {
+	switch x.Kind() {
+	case constant.Int, constant.Float, constant.Complex:
+		return true
+	}
+	return false
+}
+
+// matchConst reports whether x and y are of kinds that can be combined: both
+// numbers, both strings or both booleans.
+func matchConst(x, y constant.Value) bool {
+	if isNumeric(x) && isNumeric(y) {
+		return true
+	}
+	return x.Kind() == y.Kind() && x.Kind() != constant.Unknown
+}
+
+// resolveLengths sets the Length of each array in code whose length is a
+// constant expression that can be evaluated with consts, including arrays
+// nested in type references.
+func resolveLengths(code []Type, consts map[string]constant.Value) {
+	for _, t := range code {
+		for _, ref := range t.GetTypeRefs() {
+			ref.Walk(func(r *TypeRef) bool {
+				if n, ok := evalLength(r.LengthExpr, consts); ok {
+					r.Length, r.LengthExpr = n, ""
+				}
+				return true
+			})
+		}
+		switch tt := t.(type) {
+		case *ArrayType:
+			if n, ok := evalLength(tt.LengthExpr, consts); ok {
+				tt.Length, tt.LengthExpr = n, ""
+			}
+		case *StructType:
+			fields := make([]Type, len(tt.Fields))
+			for i, field := range tt.Fields {
+				fields[i] = field.Type
+			}
+			resolveLengths(fields, consts)
+		}
+	}
+}
+
+// evalLength evaluates the length of an array, reporting false if it is not a
+// positive constant.
+func evalLength(lengthExpr string, consts map[string]constant.Value) (int, bool) {
+	if lengthExpr == "" || lengthExpr == "..." {
+		return 0, false
+	}
+	expr, err := parser.ParseExpr(lengthExpr)
+	if err != nil {
+		return 0, false
+	}
+	n, ok := constant.Int64Val(evalConst(expr, consts, nil, 0))
+	return int(n), ok && n > 0
+}
@@ -0,0 +1,130 @@
+package toast
+
+import (
+	"errors"
+	"fmt"
+	"go/token"
+	"strings"
+)
+
+// Severity is how serious a Diagnostic is.
+type Severity int
+
+const (
+	// SeverityWarning is for something that was rendered imprecisely, such as
+	// a type expression that could not be parsed. NewFile only fails on
+	// warnings with WithStrict.
+	SeverityWarning Severity = iota
+	// SeverityError is for a declaration that could not be parsed. NewFile
+	// fails on errors, unless WithLenient is given, in which case the
+	// declaration is left out.
+	SeverityError
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Codes of the diagnostics reported by NewFile.
+const (
+	// CodeUnknownType is reported for a declaration or field whose type is
+	// not a type expression.
+	CodeUnknownType = "unknown-type"
+	// CodeBadTag is reported for a struct field with a malformed tag.
+	CodeBadTag = "bad-tag"
+	// CodeUnhandledType is reported for a type expression nested in a type
+	// that could not be parsed, and that is rendered as top in CUE.
+	CodeUnhandledType = "unhandled-type"
+	// CodeUnbundled is reported for a type of another package that could not
+	// be bundled with WithBundle.
+	CodeUnbundled = "unbundled"
+	// CodeUnsupportedRule is reported for a rule of a validate tag or a
+	// kubebuilder marker that cannot be translated into Constraints.
+	CodeUnsupportedRule = "unsupported-rule"
+	// CodeBadDirective is reported for a toast directive that is unknown or
+	// cannot be applied.
+	CodeBadDirective = "bad-directive"
+)
+
+// Diagnostic is a problem found while parsing a file.
+type Diagnostic struct {
+	Severity Severity  `json:"severity"`
+	Code     string    `json:"code"`
+	Message  string    `json:"message"`
+	Pos      *Position `json:"pos,omitempty"`
+}
+
+// String renders d as "file:line:column: severity: message".
+func (d *Diagnostic) String() string {
+	s := fmt.Sprintf("%s: %s", d.Severity, d.Message)
+	if d.Pos != nil {
+		s = d.Pos.String() + ": " + s
+	}
+	return s
+}
+
+// Diagnostics are the problems found while parsing a file, in the order they
+// were found. NewFile returns them as its error when it fails because of them.
+type Diagnostics []*Diagnostic
+
+func (ds Diagnostics) Error() string {
+	strs := make([]string, len(ds))
+	for i, d := range ds {
+		strs[i] = d.String()
+	}
+	return strings.Join(strs, "\n")
+}
+
+// HasErrors reports whether any of ds is an error rather than a warning.
+func (ds Diagnostics) HasErrors() bool {
+	for _, d := range ds {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// parseError is an error found by a parse function, with the position it was
+// found at, which NewFile turns into a Diagnostic.
+type parseError struct {
+	code string
+	pos  token.Pos
+	err  error
+}
+
+func (e *parseError) Error() string { return e.err.Error() }
+func (e *parseError) Unwrap() error { return e.err }
+
+// diagnose records a diagnostic for err, which may be a parseError.
+func (f *File) diagnose(severity Severity, err error) {
+	d := &Diagnostic{Severity: severity, Message: err.Error()}
+	var pe *parseError
+	if errors.As(err, &pe) {
+		d.Code = pe.code
+		if f.fset != nil && pe.pos.IsValid() {
+			d.Pos = &Position{pos: pe.pos}
+			d.Pos.resolve(f.fset)
+		}
+	}
+	f.Diagnostics = append(f.Diagnostics, d)
+}
+
+// failed reports whether NewFile fails because of the diagnostics recorded,
+// according to WithStrict or WithLenient.
+func (f *File) failed() bool {
+	switch {
+	case f.lenient:
+		return false
+	case f.strict:
+		return len(f.Diagnostics) > 0
+	}
+	return f.Diagnostics.HasErrors()
+}
@@ -0,0 +1,212 @@
+package toast
+
+import (
+	"fmt"
+	"go/constant"
+	"go/parser"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/fatih/structtag"
+)
+
+// directiveRe matches a toast directive line of a doc comment, such as
+//
+//	//toast:name=Foo
+//	//toast:skip
+var directiveRe = regexp.MustCompile(`^//toast:([a-z]+)(?:=(.*))?$`)
+
+// applyDirectives moves the toast directives of the declaration t and of its
+// fields out of their docs and applies them, before the transforms:
+//
+//   - skip leaves out the declaration or field.
+//   - name=Foo renames the declaration, and the references to it, or names
+//     the field in the output, as its json tag does.
+//   - type=string replaces the type of the declaration or field.
+//   - optional makes a field optional.
+//   - enum makes the declaration an EnumType, with the values of its
+//     constants, or else those given to it, as in enum=a;b, or of its
+//     kubebuilder enum marker.
+//
+// It returns the declaration to add, or nil if it is left out.
+func (f *File) applyDirectives(t Type) Type {
+	return f.applyTypeDirectives(t, "", true)
+}
+
+func (f *File) applyTypeDirectives(t Type, path string, decl bool) Type {
+	if docs, lines := splitLines(t.GetDocs(), directiveRe); lines != nil {
+		t.setDocs(docs)
+		t.meta().Directives = make(map[string]string, len(lines))
+		for _, d := range lines {
+			t.meta().Directives[d.Name] = d.Value
+		}
+	}
+	directives := t.GetDirectives()
+	for _, key := range sortedKeys(directives) {
+		value := directives[key]
+		switch {
+		case key == "skip" && value == "":
+			return nil
+		case key == "name" && value != "":
+			if decl {
+				if f.renames == nil {
+					f.renames = make(map[string]string)
+				}
+				f.renames[t.GetName()] = value
+				t.setName(value)
+			}
+		case key == "type" && value != "":
+			expr, err := parser.ParseExpr(value)
+			if err != nil {
+				f.badDirective(t, path, key, value)
+				continue
+			}
+			t = &PlainType{
+				Name: t.GetName(),
+				Type: TypeRefFromExpr(expr),
+				Meta: Meta{Directives: directives, Comment: t.GetComment(), Pos: t.GetPos()},
+				Docs: t.GetDocs(),
+			}
+		case key == "optional" && value == "" && !decl:
+		case key == "enum" && decl:
+			if _, ok := t.(*PlainType); !ok && directives["type"] == "" {
+				f.badDirective(t, path, key, value)
+			}
+		default:
+			f.badDirective(t, path, key, value)
+		}
+	}
+	if st, ok := t.(*StructType); ok {
+		var fields []*Field
+		for _, field := range st.Fields {
+			ft := f.applyTypeDirectives(field.Type, path+st.Name+".", false)
+			if ft == nil {
+				continue
+			}
+			field.Type = ft
+			if name := ft.GetDirectives()["name"]; name != "" {
+				setJSONName(field, name)
+			}
+			fields = append(fields, field)
+		}
+		st.Fields = fields
+	}
+	return t
+}
+
+func (f *File) badDirective(t Type, path, key, value string) {
+	directive := "toast:" + key
+	if value != "" {
+		directive += "=" + value
+	}
+	f.Diagnostics = append(f.Diagnostics, &Diagnostic{
+		Severity: SeverityWarning,
+		Code:     CodeBadDirective,
+		Message:  fmt.Sprintf("%s%s: directive %s cannot be applied", path, t.GetName(), directive),
+		Pos:      t.GetPos(),
+	})
+}
+
+// setJSONName names field in its json tag, keeping its options.
+func setJSONName(field *Field, name string) {
+	tag := &structtag.Tag{Key: "json"}
+	if existing := field.tag("json"); existing != nil {
+		tag.Options = existing.Options
+	}
+	tag.Name = name
+	if field.Tags == nil {
+		field.Tags = &structtag.Tags{}
+	}
+	field.Tags.Set(tag)
+}
+
+// renameRefs renames the references in code to the declarations renamed by a
+// name directive, as well as the types of their constants.
+func (f *File) renameRefs(code []Type) {
+	if len(f.renames) == 0 {
+		return
+	}
+	for _, t := range code {
+		if st, ok := t.(*StructType); ok {
+			fields := make([]Type, len(st.Fields))
+			for i, field := range st.Fields {
+				fields[i] = field.Type
+			}
+			f.renameRefs(fields)
+			renameEmbedded(st)
+			continue
+		}
+		for _, ref := range t.GetTypeRefs() {
+			ref.Walk(func(r *TypeRef) bool {
+				if name, ok := f.renames[r.Name]; ok && r.Kind == RefNamed && r.Package == "" {
+					r.Name = name
+				}
+				return true
+			})
+		}
+	}
+	for _, ec := range f.enumConsts {
+		if name, ok := f.renames[ec.typeName]; ok {
+			ec.typeName = name
+		}
+	}
+}
+
+// directiveEnumValues returns the values of an enum given by the enum
+// directive of pt, or else by its enum constraint. Each is named after the
+// type and the value, e.g. PolicyAlways.
+func (f *File) directiveEnumValues(pt *PlainType) []*EnumValue {
+	kind := f.refKind(pt.Type, 0)
+	var values []interface{}
+	if value := pt.Directives["enum"]; value != "" {
+		for _, v := range strings.Split(value, ";") {
+			ev, ok := markerValue(strings.TrimSpace(v), kind)
+			if !ok {
+				return nil
+			}
+			values = append(values, ev)
+		}
+	} else if pt.Constraints != nil {
+		values = pt.Constraints.Enum
+	}
+	var evs []*EnumValue
+	for _, v := range values {
+		var cv constant.Value
+		switch v := v.(type) {
+		case string:
+			cv = constant.MakeString(v)
+		case float64:
+			cv = constant.MakeFloat64(v)
+			if i := constant.ToInt(cv); i.Kind() == constant.Int {
+				cv = i
+			}
+		case bool:
+			cv = constant.MakeBool(v)
+		default:
+			return nil
+		}
+		evs = append(evs, &EnumValue{Name: enumValueName(pt.Name, fmt.Sprint(v)), Value: cv})
+	}
+	return evs
+}
+
+// enumValueName returns the name of the constant of an enum with the given
+// value, made of the letters and digits of the value, e.g. TypeFooBar for
+// foo-bar.
+func enumValueName(typeName, value string) string {
+	name := typeName
+	upper := true
+	for _, r := range value {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+		}
+		name += string(r)
+		upper = false
+	}
+	return name
+}
@@ -0,0 +1,236 @@
+package toast
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/constant"
+	"strconv"
+	"strings"
+)
+
+// EnumValue is a constant of an EnumType. Value is nil for an enum promoted
+// with a transform whose values are their names, as for a string enum, and
+// which are rendered as before EnumValue existed: as untyped constants named
+// after the enum and the value, such as MyEnum_A = "A". Like Method, it
+// includes its docs in its JSON representation.
+type EnumValue struct {
+	Name    string
+	Value   constant.Value
+	Docs    string
+	Comment string
+}
+
+func (v *EnumValue) MarshalJSON() ([]byte, error) {
+	type enumValue struct {
+		Name    string          `json:"name"`
+		Value   json.RawMessage `json:"value,omitempty"`
+		Docs    string          `json:"docs,omitempty"`
+		Comment string          `json:"comment,omitempty"`
+	}
+	ev := enumValue{Name: v.Name, Docs: v.Docs, Comment: v.Comment}
+	if v.Value != nil {
+		switch v.Value.Kind() {
+		case constant.String:
+			ev.Value, _ = json.Marshal(constant.StringVal(v.Value))
+		case constant.Float:
+			f, _ := constant.Float64Val(v.Value)
+			ev.Value = json.RawMessage(strconv.FormatFloat(f, 'g', -1, 64))
+		default:
+			ev.Value = json.RawMessage(v.Value.ExactString())
+		}
+	}
+	return json.Marshal(ev)
+}
+
+// constName returns the name of the constant of v in the enum named enum.
+func (v *EnumValue) constName(enum string) string {
+	if v.Value == nil {
+		return enum + "_" + v.Name
+	}
+	return v.Name
+}
+
+// literal returns the value as a Go or CUE literal.
+func (v *EnumValue) literal() string {
+	if v.Value == nil {
+		return strconv.Quote(v.Name)
+	}
+	if v.Value.Kind() == constant.Float {
+		f, _ := constant.Float64Val(v.Value)
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return v.Value.ExactString()
+}
+
+// enumConst is a constant declared with a named type, which may make that
+// type an enum. block is the declaration of the constant. explicit is set on
+// constants that make their type an enum on their own: those declared with
+// iota, and those generated by protoc-gen-go.
+type enumConst struct {
+	typeName string
+	value    *EnumValue
+	block    *ast.GenDecl
+	explicit bool
+}
+
+// enumConstType returns the name of the type of the constants of spec, given
+// that of the previous spec of its declaration, which it repeats if it has no
+// type or values, as in a block using iota. It is empty for untyped constants
+// and those of types of other packages.
+func enumConstType(spec *ast.ValueSpec, prev string) string {
+	if spec.Type != nil {
+		if id, ok := spec.Type.(*ast.Ident); ok {
+			return id.Name
+		}
+		return ""
+	}
+	if len(spec.Values) == 0 {
+		return prev
+	}
+	// A conversion such as Color(iota).
+	if call, ok := spec.Values[0].(*ast.CallExpr); ok {
+		if id, ok := call.Fun.(*ast.Ident); ok {
+			return id.Name
+		}
+	}
+	return ""
+}
+
+// usesIota reports whether the constants of spec are declared with iota,
+// given whether those of the previous spec of its declaration are, which it
+// repeats if it has no values.
+func usesIota(spec *ast.ValueSpec, prev bool) bool {
+	if len(spec.Values) == 0 {
+		return prev
+	}
+	found := false
+	for _, v := range spec.Values {
+		ast.Inspect(v, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && id.Name == "iota" {
+				found = true
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// promoteEnums makes an EnumType of each declaration in the file of a basic
+// type that a block of constants is declared with, using iota or with
+// several of them, such as
+//
+//	type Color int
+//
+//	const (
+//		Red Color = iota
+//		Green
+//	)
+//
+// or that has the value maps generated by protoc-gen-go (see protoEnumConsts),
+// or that has an enum directive (see applyDirectives) or +enum marker. A
+// single constant, such as a default, does not make its type an enum.
+// Constants whose values cannot be evaluated are left out.
+func (f *File) promoteEnums() {
+	type block struct {
+		typeName string
+		decl     *ast.GenDecl
+	}
+	values := make(map[string][]*EnumValue)
+	enums := make(map[string]bool)
+	counts := make(map[block]int)
+	seen := make(map[string]bool)
+	for _, ec := range f.enumConsts {
+		if ec.value.Value == nil {
+			ec.value.Value = f.consts[ec.value.Name]
+		}
+		if ec.value.Value != nil && !seen[ec.value.Name] {
+			seen[ec.value.Name] = true
+			values[ec.typeName] = append(values[ec.typeName], ec.value)
+			b := block{ec.typeName, ec.block}
+			counts[b]++
+			if ec.explicit || ec.block != nil && counts[b] > 1 {
+				enums[ec.typeName] = true
+			}
+		}
+	}
+	for i, t := range f.Code {
+		pt, ok := t.(*PlainType)
+		if !ok {
+			continue
+		}
+		// An enum directive or +enum marker makes pt an enum even with a
+		// single constant, or without any.
+		_, directive := pt.Directives["enum"]
+		marker := hasMarker(pt.Markers, "enum")
+		vs := values[pt.Name]
+		if !enums[pt.Name] && !directive && !marker {
+			vs = nil
+		}
+		if len(vs) == 0 && (directive || marker) {
+			vs = f.directiveEnumValues(pt)
+		}
+		if pt.Alias || len(pt.TypeParams) > 0 || pt.Type.Pointer || !pt.Type.IsBasic() || len(vs) == 0 {
+			if directive {
+				f.badDirective(pt, "", "enum", pt.Directives["enum"])
+			} else if marker {
+				f.unsupportedRule(pt, pt.Name+": marker +enum")
+			}
+			continue
+		}
+		f.Code[i] = &EnumType{
+			Name:   pt.Name,
+			Type:   pt.Type,
+			Values: vs,
+			Meta:   pt.Meta,
+			Docs:   pt.Docs,
+		}
+	}
+}
+
+// protoEnumConsts returns the values of an enum given by the maps that
+// protoc-gen-go generates for it, such as
+//
+//	MyEnum_name = map[int32]string{0: "ZERO"}
+//	MyEnum_value = map[string]int32{"ZERO": 0}
+//
+// Each is named after the constant generated for it, e.g. MyEnum_ZERO.
+func protoEnumConsts(spec *ast.ValueSpec) []*enumConst {
+	var ecs []*enumConst
+	for i, name := range spec.Names {
+		if i >= len(spec.Values) {
+			break
+		}
+		lit, ok := spec.Values[i].(*ast.CompositeLit)
+		if !ok {
+			continue
+		}
+		if _, ok := lit.Type.(*ast.MapType); !ok {
+			continue
+		}
+		typeName, byName := strings.TrimSuffix(name.Name, "_value"), true
+		if typeName == name.Name {
+			typeName, byName = strings.TrimSuffix(name.Name, "_name"), false
+		}
+		if typeName == name.Name || typeName == "" {
+			continue
+		}
+		for _, elt := range lit.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				continue
+			}
+			key, value := evalConst(kv.Key, nil, nil, 0), evalConst(kv.Value, nil, nil, 0)
+			if !byName {
+				key, value = value, key
+			}
+			if key.Kind() != constant.String || value.Kind() != constant.Int {
+				continue
+			}
+			ecs = append(ecs, &enumConst{typeName: typeName, explicit: true, value: &EnumValue{
+				Name:  typeName + "_" + constant.StringVal(key),
+				Value: value,
+			}})
+		}
+	}
+	return ecs
+}
@@ -4,11 +4,11 @@ go 1.22
 
 require (
 	github.com/fatih/structtag v1.2.0
+	golang.org/x/mod v0.5.1
 	golang.org/x/tools v0.1.9
 )
 
 require (
-	golang.org/x/mod v0.5.1 // indirect
 	golang.org/x/sys v0.0.0-20211019181941-9d821ace8654 // indirect
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 )
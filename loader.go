@@ -0,0 +1,169 @@
+package toast
+
+import (
+	"fmt"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"os"
+	"path"
+	"path/filepath"
+
+	"golang.org/x/mod/modfile"
+)
+
+// LoadPackage is like NewPackage, but also type-checks the package in dir
+// with go/types, so that each named type reference is resolved to its package
+// path and underlying type. Imports are loaded from source, from the module of
+// dir and the module cache, as the go command would find them.
+func LoadPackage(dir string, opts ...Option) (*File, error) {
+	fset := token.NewFileSet()
+	files, err := parseDir(fset, dir)
+	if err != nil {
+		return nil, err
+	}
+	pkgPath, err := importPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, err := conf.Check(pkgPath, fset, files, nil)
+	if err != nil {
+		return nil, err
+	}
+	return NewPackageFromFiles(files, append([]Option{WithFileSet(fset), WithTypes(pkg)}, opts...)...)
+}
+
+// importPath returns the import path of the package in dir, from the path of
+// the module it is in.
+func importPath(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for modDir := dir; ; modDir = filepath.Dir(modDir) {
+		if data, err := os.ReadFile(filepath.Join(modDir, "go.mod")); err == nil {
+			rel, err := filepath.Rel(modDir, dir)
+			if err != nil {
+				return "", err
+			}
+			return path.Join(modfile.ModulePath(data), filepath.ToSlash(rel)), nil
+		}
+		if filepath.Dir(modDir) == modDir {
+			return "", fmt.Errorf("%s: not in a module", dir)
+		}
+	}
+}
+
+// resolveTypes sets the package path and underlying type of each named type
+// referenced in code, using the type information given with WithTypes.
+func (f *File) resolveTypes(code []Type) {
+	for _, t := range code {
+		for _, ref := range t.GetTypeRefs() {
+			ref.Walk(func(r *TypeRef) bool {
+				if r.Kind == RefNamed && !r.IsBasic() {
+					f.resolveType(r)
+				}
+				return true
+			})
+		}
+	}
+}
+
+func (f *File) resolveType(r *TypeRef) {
+	scope := f.types.Scope()
+	if r.Package != "" {
+		imp, ok := f.Imports[r.Package]
+		if !ok {
+			return
+		}
+		scope = nil
+		for _, pkg := range f.types.Imports() {
+			if pkg.Path() == imp.GetOldPath() {
+				scope = pkg.Scope()
+			}
+		}
+		if scope == nil {
+			return
+		}
+	}
+	obj, ok := scope.Lookup(r.Name).(*types.TypeName)
+	if !ok {
+		return
+	}
+	if obj.Pkg() != nil {
+		r.Path = obj.Pkg().Path()
+	}
+	r.Underlying = TypeRefFromType(types.Unalias(obj.Type()).Underlying())
+}
+
+// TypeRefFromType returns a reference to a type from go/types. Struct and
+// interface types are kept as source, as in TypeRefFromExpr.
+func TypeRefFromType(t types.Type) *TypeRef {
+	switch tt := types.Unalias(t).(type) {
+	case *types.Basic:
+		return &TypeRef{Kind: RefNamed, Name: tt.Name()}
+	case *types.Named:
+		ref := &TypeRef{Kind: RefNamed, Name: tt.Obj().Name()}
+		if pkg := tt.Obj().Pkg(); pkg != nil {
+			ref.Package, ref.Path = pkg.Name(), pkg.Path()
+		}
+		for i := 0; i < tt.TypeArgs().Len(); i++ {
+			ref.Args = append(ref.Args, TypeRefFromType(tt.TypeArgs().At(i)))
+		}
+		return ref
+	case *types.TypeParam:
+		return &TypeRef{Kind: RefNamed, Name: tt.Obj().Name()}
+	case *types.Pointer:
+		return TypeRefFromType(tt.Elem()).pointerTo()
+	case *types.Slice:
+		return &TypeRef{Kind: RefSlice, Elem: TypeRefFromType(tt.Elem())}
+	case *types.Array:
+		return &TypeRef{Kind: RefArray, Elem: TypeRefFromType(tt.Elem()), Length: int(tt.Len())}
+	case *types.Map:
+		return &TypeRef{Kind: RefMap, Key: TypeRefFromType(tt.Key()), Value: TypeRefFromType(tt.Elem())}
+	case *types.Chan:
+		dir := ChanBoth
+		switch tt.Dir() {
+		case types.SendOnly:
+			dir = ChanSend
+		case types.RecvOnly:
+			dir = ChanRecv
+		}
+		return &TypeRef{Kind: RefChan, Elem: TypeRefFromType(tt.Elem()), Dir: dir}
+	case *types.Signature:
+		return &TypeRef{Kind: RefFunc, Params: paramsFromTuple(tt.Params(), tt.Variadic()), Results: paramsFromTuple(tt.Results(), false)}
+	case *types.Struct:
+		return &TypeRef{Kind: RefStruct, Expr: types.TypeString(tt, packageName)}
+	case *types.Interface:
+		return &TypeRef{Kind: RefInterface, Expr: types.TypeString(tt, packageName)}
+	case *types.Union:
+		ref := &TypeRef{Kind: RefUnion}
+		for i := 0; i < tt.Len(); i++ {
+			term := TypeRefFromType(tt.Term(i).Type())
+			term.Tilde = tt.Term(i).Tilde()
+			ref.Terms = append(ref.Terms, term)
+		}
+		return ref
+	}
+	return &TypeRef{Kind: RefInvalid, Expr: t.String()}
+}
+
+func paramsFromTuple(tuple *types.Tuple, variadic bool) []*Param {
+	var params []*Param
+	for i := 0; i < tuple.Len(); i++ {
+		v := tuple.At(i)
+		p := &Param{Name: v.Name(), Type: TypeRefFromType(v.Type())}
+		if variadic && i == tuple.Len()-1 {
+			p.Type, p.Variadic = p.Type.Elem, true
+		}
+		params = append(params, p)
+	}
+	return params
+}
+
+// packageName qualifies the types of other packages by package name, as in
+// source.
+func packageName(pkg *types.Package) string {
+	return pkg.Name()
+}
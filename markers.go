@@ -0,0 +1,265 @@
+package toast
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Marker is a marker line of a doc comment, such as
+// +kubebuilder:validation:Minimum=1. Value is empty for a marker without one,
+// such as +optional.
+type Marker struct {
+	Name  string `json:"name"`
+	Value string `json:"value,omitempty"`
+}
+
+// markerRe matches a marker line of a doc comment, such as
+//
+//	// +kubebuilder:validation:Minimum=1
+//	// +optional
+var markerRe = regexp.MustCompile(`^//\s*\+([A-Za-z][\w:.-]*)(?:=(.*))?$`)
+
+// splitMarkers separates the markers of docs from its other lines, returning
+// the docs without them and the markers in the order they appear in, repeats
+// included.
+func splitMarkers(docs string) (string, []*Marker) {
+	if !strings.Contains(docs, "+") {
+		return docs, nil
+	}
+	return splitLines(docs, markerRe)
+}
+
+// splitLines separates the lines of docs that re matches, capturing a name
+// and an optional value, from its other lines.
+func splitLines(docs string, re *regexp.Regexp) (string, []*Marker) {
+	var matches []*Marker
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSuffix(docs, "\n"), "\n") {
+		m := re.FindStringSubmatch(line)
+		if m == nil {
+			lines = append(lines, line)
+			continue
+		}
+		matches = append(matches, &Marker{Name: m[1], Value: strings.TrimSpace(m[2])})
+	}
+	if matches == nil {
+		return docs, nil
+	}
+	// Leave out the blank comment lines that separated the matches.
+	for len(lines) > 0 && strings.TrimSpace(strings.TrimPrefix(lines[len(lines)-1], "//")) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return "", matches
+	}
+	return strings.Join(lines, "\n") + "\n", matches
+}
+
+// resolveMarkers moves the markers of the declarations in code and of their
+// fields out of their docs, and sets the constraints of declarations of plain
+// types, arrays and maps from them. Those of fields are set with the
+// constraints of their validate tags.
+func (f *File) resolveMarkers(code []Type) {
+	for _, t := range code {
+		moveMarkers(t)
+		if len(t.GetMarkers()) == 0 {
+			continue
+		}
+		c := &Constraints{}
+		for _, marker := range c.applyMarkers(t.GetMarkers(), f.valueKind(t)) {
+			f.unsupportedRule(t, t.GetName()+": marker +"+marker)
+		}
+		if c.isZero() {
+			continue
+		}
+		switch tt := t.(type) {
+		case *PlainType:
+			tt.Constraints = c
+		case *ArrayType:
+			tt.Constraints = c
+		case *MapType:
+			tt.Constraints = c
+		}
+	}
+}
+
+// moveMarkers moves the markers of t and of its fields out of their docs.
+func moveMarkers(t Type) {
+	if docs, markers := splitMarkers(t.GetDocs()); markers != nil {
+		t.setDocs(docs)
+		t.meta().Markers = markers
+	}
+	if st, ok := t.(*StructType); ok {
+		for _, field := range st.Fields {
+			moveMarkers(field.Type)
+		}
+	}
+}
+
+// applyMarkers adds the constraints given by the optional, required and
+// kubebuilder markers to a value of the given kind, and returns the
+// kubebuilder validation markers that cannot be translated. Other markers are
+// left alone.
+func (c *Constraints) applyMarkers(markers []*Marker, kind valueKind) []string {
+	var unsupported []string
+	for _, m := range markers {
+		if !c.applyMarker(m.Name, m.Value, kind) {
+			unsupported = append(unsupported, m.String())
+		}
+	}
+	return unsupported
+}
+
+func (c *Constraints) applyMarker(name, value string, kind valueKind) bool {
+	switch name {
+	case "optional", "kubebuilder:validation:Optional":
+		c.Optional = true
+		return true
+	case "required", "kubebuilder:validation:Required":
+		c.Required = true
+		return true
+	case "kubebuilder:default", "default":
+		def, ok := markerValue(value, kind)
+		if ok {
+			c.Default = def
+		}
+		return ok
+	}
+	rule, ok := strings.CutPrefix(name, "kubebuilder:validation:")
+	if !ok {
+		return true
+	}
+	switch rule {
+	case "Minimum", "Maximum":
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil || kind != kindNumber {
+			return false
+		}
+		if rule == "Minimum" {
+			c.Minimum = &n
+		} else {
+			c.Maximum = &n
+		}
+		return true
+	case "ExclusiveMinimum", "ExclusiveMaximum":
+		b, err := strconv.ParseBool(value)
+		if err != nil || kind != kindNumber {
+			return false
+		}
+		if rule == "ExclusiveMinimum" {
+			c.ExclusiveMinimum = b
+		} else {
+			c.ExclusiveMaximum = b
+		}
+		return true
+	case "MinLength", "MaxLength":
+		if kind != kindString {
+			return false
+		}
+		return c.bound(map[string]string{"MinLength": "min", "MaxLength": "max"}[rule], value, kind)
+	case "MinItems", "MaxItems", "MinProperties", "MaxProperties":
+		if kind != kindItems {
+			return false
+		}
+		return c.bound(strings.ToLower(rule[:3]), value, kind)
+	case "Pattern":
+		if kind != kindString {
+			return false
+		}
+		pattern := unquoteMarker(value)
+		if _, err := regexp.Compile(pattern); err != nil {
+			return false
+		}
+		c.Patterns = append(c.Patterns, pattern)
+		return true
+	case "Enum":
+		for _, v := range strings.Split(value, ";") {
+			ev, ok := markerValue(strings.TrimSpace(v), kind)
+			if !ok {
+				return false
+			}
+			c.Enum = append(c.Enum, ev)
+		}
+		return true
+	case "Format":
+		if kind != kindString {
+			return false
+		}
+		c.Format = value
+		if pattern, ok := validateFormats[value]; ok {
+			c.Patterns = append(c.Patterns, pattern)
+		}
+		return true
+	}
+	return false
+}
+
+// markerValue returns the value of a marker for a value of the given kind: a
+// string, quoted or not, for a string, and otherwise the value decoded from
+// JSON.
+func markerValue(value string, kind valueKind) (interface{}, bool) {
+	if kind == kindString {
+		return unquoteMarker(value), true
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(value), &v); err != nil {
+		return nil, false
+	}
+	switch v.(type) {
+	case float64:
+		return v, kind == kindNumber
+	case bool:
+		return v, kind == kindBool
+	}
+	return v, kind == kindOther || kind == kindItems
+}
+
+// unquoteMarker removes the double quotes or backquotes around a marker
+// value, if any.
+func unquoteMarker(value string) string {
+	if s, err := strconv.Unquote(value); err == nil {
+		return s
+	}
+	return value
+}
+
+// String returns m as written after the + of its line, e.g.
+// kubebuilder:validation:Minimum=1.
+func (m *Marker) String() string {
+	if m.Value == "" {
+		return m.Name
+	}
+	return m.Name + "=" + m.Value
+}
+
+// hasMarker reports whether markers has one with the given name.
+func hasMarker(markers []*Marker, name string) bool {
+	for _, m := range markers {
+		if m.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// fmtMarkers renders the markers of t as doc comment lines, in the order they
+// were found in.
+func fmtMarkers(t Type) string {
+	var str string
+	for _, m := range t.GetMarkers() {
+		str += "// +" + m.String() + "\n"
+	}
+	return str
+}
@@ -0,0 +1,25 @@
+package mock
+
+import "bytes"
+
+// MockAlias is an alias of a defined type.
+type MockAlias = MockStr
+
+// MockBufAlias is an alias of an imported type.
+type MockBufAlias = bytes.Buffer
+
+// MockSliceAlias is an alias of a slice.
+type MockSliceAlias = []MockAlias
+
+// MockAliasOfAlias is an alias of an alias.
+type MockAliasOfAlias = MockAlias
+
+// MockDefined is a defined type, not an alias.
+type MockDefined MockStr
+
+// MockAliases refers to aliases.
+type MockAliases struct {
+	Alias   MockAlias        `json:"alias"`
+	Aliases MockSliceAlias   `json:"aliases"`
+	Nested  MockAliasOfAlias `json:"nested"`
+}
@@ -0,0 +1,26 @@
+package mock
+
+import "crypto/sha256"
+
+const (
+	idLen   = 16
+	hashLen = idLen * 2
+)
+
+// MockID is a fixed-size byte array.
+type MockID [16]byte
+
+// MockHash has a length given by a local constant.
+type MockHash [hashLen]byte
+
+// MockDigest has a length given by an imported constant.
+type MockDigest [sha256.Size]byte
+
+// MockArrays has fixed-size array fields.
+type MockArrays struct {
+	ID     [idLen]byte        `json:"id"`
+	Matrix [3][3]float64      `json:"matrix"`
+	Digest MockDigest         `json:"digest"`
+	Bytes  []byte             `json:"bytes"`
+	Sums   [sha256.Size]uint8 `json:"sums"`
+}
@@ -0,0 +1,24 @@
+package mock
+
+// Event is sent over channels.
+type Event struct {
+	Name string `json:"name"`
+}
+
+// EventChan is a bidirectional channel.
+type EventChan chan Event
+
+// EventSink only sends.
+type EventSink chan<- *Event
+
+// EventSource only receives.
+type EventSource <-chan []Event
+
+// MockWorker is a struct with channel fields.
+type MockWorker struct {
+	Name   string             `json:"name"`
+	Events chan Event         `json:"events"`
+	Done   <-chan struct{}    `json:"done"`
+	Queues []chan<- EventChan `json:"queues"`
+	Source EventSource        `json:"source"`
+}
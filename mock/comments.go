@@ -0,0 +1,16 @@
+package mock
+
+type (
+	// MockStatus is documented inside a grouped declaration.
+	MockStatus string
+
+	MockCode int // MockCode has only a trailing comment.
+)
+
+// MockComments has trailing comments on its fields.
+type MockComments struct {
+	Status MockStatus `json:"status"` // current status
+	Code   MockCode   `json:"code"`   // status code
+	// Message is documented above and after.
+	Message string `json:"message,omitempty"` // human readable
+}
@@ -0,0 +1,23 @@
+package mock
+
+import "bytes"
+
+// MockBase is embedded in other structs.
+type MockBase struct {
+	ID string `json:"id"`
+}
+
+// MockName is a non-struct type that gets embedded.
+type MockName string
+
+// MockEmbedder embeds other types.
+type MockEmbedder struct {
+	// MockBase fields are promoted.
+	MockBase
+	*bytes.Buffer `json:"-"`
+	MockName
+	mockStr
+	Named MockBase `json:"named"`
+}
+
+type mockStr string
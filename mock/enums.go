@@ -0,0 +1,29 @@
+package mock
+
+// MockColor is an enum declared with iota.
+type MockColor int
+
+const (
+	// MockRed is the first color.
+	MockRed   MockColor = iota
+	MockGreen           // second
+	MockBlue
+)
+
+// MockKind is an enum of strings.
+type MockKind string
+
+const (
+	MockKindPod     MockKind = "pod"
+	MockKindService MockKind = "service"
+)
+
+// MockFlag is an enum of bit flags.
+type MockFlag uint8
+
+const (
+	MockFlagRead MockFlag = 1 << iota
+	MockFlagWrite
+	_
+	MockFlagExec
+)
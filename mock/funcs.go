@@ -0,0 +1,24 @@
+package mock
+
+import (
+	"bytes"
+	"context"
+)
+
+// HandlerFunc handles a request.
+type HandlerFunc func(ctx context.Context, req *bytes.Buffer, opts ...string) (int, error)
+
+// Callback is a function without parameters or results.
+type Callback func()
+
+// Mapper is a generic function.
+type Mapper[T, U any] func(T) U
+
+// MockHooks is a struct with function fields.
+type MockHooks struct {
+	// OnEvent is called for every event.
+	OnEvent func(name string, payload []byte) error `json:"onEvent"`
+	Handler HandlerFunc                             `json:"handler"`
+	Filters []func(string) bool                     `json:"filters"`
+	Name    string                                  `json:"name"`
+}
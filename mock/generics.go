@@ -0,0 +1,36 @@
+package mock
+
+// Page is a generic page of results.
+type Page[T any] struct {
+	Items []T     `json:"items"`
+	Next  *string `json:"next,omitempty"`
+	Total int     `json:"total"`
+}
+
+// Pair is a generic key-value pair.
+type Pair[K comparable, V any] struct {
+	Key   K `json:"key"`
+	Value V `json:"value"`
+}
+
+// List is a generic list.
+type List[T any] []T
+
+// Set is a generic set.
+type Set[T comparable] map[T]struct{}
+
+// Number is a generic number.
+type Number[T ~int | ~float64] struct {
+	Value T `json:"value"`
+}
+
+// ImplPage is a page of Impls.
+type ImplPage Page[Impl]
+
+// MockResults uses instantiated generic types.
+type MockResults struct {
+	Impls Page[Impl]          `json:"impls"`
+	Pairs []Pair[string, int] `json:"pairs"`
+	Names List[MockStr]       `json:"names"`
+	Count Number[int]         `json:"count"`
+}
@@ -0,0 +1,34 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+)
+
+// MockService is an interface with documented methods.
+type MockService interface {
+	fmt.Stringer
+
+	// Get returns the struct with the given name.
+	Get(ctx context.Context, name string) (*MockStruct, error)
+	// List returns every struct.
+	List(ctx context.Context, opts ...string) ([]MockStruct, error)
+	// Close closes the service.
+	Close()
+}
+
+// MockNumber is a constraint interface.
+type MockNumber interface {
+	~int | ~int64 | ~float64
+}
+
+// MockEmptyIface is an empty interface.
+type MockEmptyIface interface{}
+
+// MockIfaceHolder holds interfaces.
+type MockIfaceHolder struct {
+	Any     interface{}                `json:"any"`
+	Service MockService                `json:"service"`
+	Inline  interface{ Len() int }     `json:"inline"`
+	Many    []interface{ Get() error } `json:"many"`
+}
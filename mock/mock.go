@@ -98,3 +98,10 @@ type MockSlicePointer []*int
 
 // MockNonStringMap does not get generated because it has no string key.
 type MockNonStringMap map[int]string
+
+// MockPoint declares several fields at once.
+type MockPoint struct {
+	// coordinates
+	X, Y, Z float64 `yaml:"coord"`
+	Label   string  `json:"label"`
+}
@@ -1,7 +1,27 @@
 package toast
 
+import (
+	"go/token"
+	"go/types"
+)
+
 type Option func(*File)
 
+// Policy controls how the CUE and JSON (Reflect) outputs handle Go types that
+// have no equivalent in them, such as functions and channels. Go output is not
+// affected.
+type Policy int
+
+const (
+	// PolicyTop keeps declarations and fields of the type. CUE renders them as
+	// top (_), which accepts any value.
+	PolicyTop Policy = iota
+	// PolicySkip leaves declarations and fields of the type out.
+	PolicySkip
+	// PolicyError makes NewFile fail when it finds the type.
+	PolicyError
+)
+
 func WithPackageName(packageName string) Option {
 	return func(f *File) {
 		f.pkgName = packageName
@@ -14,6 +34,91 @@ func WithCUEPackageName(packageName string) Option {
 	}
 }
 
+// WithCUEInlineAliases makes CUE output refer to the aliased type wherever an
+// alias declared with "type A = B" is used, instead of defining the alias.
+func WithCUEInlineAliases() Option {
+	return func(f *File) {
+		f.cueInlineAliases = true
+	}
+}
+
+// WithEncodingJSON makes CUE output follow encoding/json in naming fields:
+// fields without a name in their json tag are named after the Go field rather
+// than left out, fields tagged "-" and unexported fields are left out, and
+// numbers and booleans with the string option are strings.
+func WithEncodingJSON() Option {
+	return func(f *File) {
+		f.encodingJSON = true
+	}
+}
+
+// WithNameTag sets the struct tags that CUE output takes the names of fields
+// and their omitempty option from, in order of preference, instead of json.
+// With WithNameTag("yaml", "json"), a field is named after its yaml tag, or
+// its json tag if it has none. An inline or squash option, as in yaml and
+// mapstructure tags, promotes the fields of the field's type. A protobuf tag
+// names a field as protojson does.
+func WithNameTag(keys ...string) Option {
+	return func(f *File) {
+		f.nameTags = keys
+	}
+}
+
+// WithStrict makes NewFile fail on any diagnostic, including warnings.
+func WithStrict() Option {
+	return func(f *File) {
+		f.strict, f.lenient = true, false
+	}
+}
+
+// WithLenient makes NewFile leave out declarations that cannot be parsed, and
+// record an error diagnostic for each, instead of failing.
+func WithLenient() Option {
+	return func(f *File) {
+		f.strict, f.lenient = false, true
+	}
+}
+
+// WithTypes sets the type-checked package the file belongs to, so that named
+// type references are resolved to their package path and underlying type.
+// LoadPackage sets it.
+func WithTypes(pkg *types.Package) Option {
+	return func(f *File) {
+		f.types = pkg
+	}
+}
+
+// WithBundle makes NewFile include the declarations of the types of other
+// packages that the file refers to, so that its output is self-contained.
+// Packages are found in the module or GOPATH, and the standard library is
+// left out. Each bundled type is named after its package, e.g. meta_Object
+// for meta.Object, and the references to it are rewritten. The file set must
+// be given with WithFileSet, or the file parsed with NewPackage, for imports
+// to be found relative to the file.
+func WithBundle() Option {
+	return func(f *File) {
+		f.bundle = true
+	}
+}
+
+// WithProtobuf makes NewFile read types generated by protoc-gen-go as
+// protojson encodes them: the internal fields of messages are left out, JSON
+// names are taken from the protobuf tag, and oneof fields are resolved to the
+// wrapper types they can hold.
+func WithProtobuf() Option {
+	return func(f *File) {
+		f.protobuf = true
+	}
+}
+
+// WithFileSet sets the file set the file was parsed with, so that NewFile can
+// record the position of each node, and report it in errors.
+func WithFileSet(fset *token.FileSet) Option {
+	return func(f *File) {
+		f.fset = fset
+	}
+}
+
 func WithTransform(t Transform) Option {
 	return func(f *File) {
 		switch tt := t.(type) {
@@ -23,6 +128,7 @@ func WithTransform(t Transform) Option {
 			f.modimports = append(f.modimports, tt)
 		case *CopyIntoStruct:
 			f.copies = append(f.copies, tt)
+			f.trans = append(f.trans, tt)
 		case *GenEnumTypeTransform:
 			f.genEnumTrans = append(f.genEnumTrans, tt)
 		default:
@@ -30,3 +136,18 @@ func WithTransform(t Transform) Option {
 		}
 	}
 }
+
+// WithFuncPolicy sets the policy for function types. Defaults to PolicyTop.
+func WithFuncPolicy(p Policy) Option {
+	return func(f *File) {
+		f.funcPolicy = p
+	}
+}
+
+// WithChanPolicy sets the policy for channel types. Defaults to PolicySkip,
+// since channels are almost always internal.
+func WithChanPolicy(p Policy) Option {
+	return func(f *File) {
+		f.chanPolicy = p
+	}
+}
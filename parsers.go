@@ -3,60 +3,152 @@ package toast
 import (
 	"fmt"
 	"go/ast"
-	"log"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/fatih/structtag"
 )
 
 func NewFile(file *ast.File, opts ...Option) (*File, error) {
+	return NewPackageFromFiles([]*ast.File{file}, opts...)
+}
+
+// NewPackage parses the Go files in dir, leaving out tests, as a single File
+// holding the declarations of the whole package. The file set is recorded,
+// so that each declaration can be traced back to its source file with Split.
+func NewPackage(dir string, opts ...Option) (*File, error) {
+	fset := token.NewFileSet()
+	files, err := parseDir(fset, dir)
+	if err != nil {
+		return nil, err
+	}
+	return NewPackageFromFiles(files, append([]Option{WithFileSet(fset)}, opts...)...)
+}
+
+// parseDir parses the Go files in dir, leaving out tests and the files that
+// the build constraints of the default build context exclude, such as those
+// for other platforms or tagged "ignore".
+func parseDir(fset *token.FileSet, dir string) ([]*ast.File, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []*ast.File
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if ok, err := build.Default.MatchFile(dir, name); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+		file, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: no Go files", dir)
+	}
+	return files, nil
+}
+
+// NewPackageFromFiles is like NewFile for the files of a package, which are
+// parsed as one: transforms apply across files, and the imports and
+// declarations of all of them are merged. References are qualified with the
+// imports of their own file, which are renamed where two files import
+// different packages under the same name.
+func NewPackageFromFiles(files []*ast.File, opts ...Option) (*File, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files")
+	}
 
 	f := &File{
-		pkgName: file.Name.Name,
-		Imports: make(map[string]Import),
+		pkgName:    files[0].Name.Name,
+		Imports:    make(map[string]Import),
+		chanPolicy: PolicySkip,
 	}
 
 	for _, opt := range opts {
 		opt(f)
 	}
 
+	if f.fset != nil {
+		f.srcDir, _ = filepath.Abs(filepath.Dir(f.fset.Position(files[0].Package).Filename))
+	}
+
+	var decls []ast.Decl
+	for _, file := range files {
+		if file.Name.Name != files[0].Name.Name {
+			return nil, fmt.Errorf("files of packages %s and %s", files[0].Name.Name, file.Name.Name)
+		}
+		decls = append(decls, file.Decls...)
+	}
+
+	f.consts = ConstsFromDecls(decls)
+
+	for _, file := range files {
+		renames := f.addImports(file)
+		f.declareFile(file, renames)
+	}
+
+	return f.finish()
+}
+
+// declareFile adds the declarations of file to f. renames are the names that
+// its imports were added under, as returned by addImports.
+func (f *File) declareFile(file *ast.File, renames map[string]string) {
 	for _, fileDecl := range file.Decls {
 		switch decl := fileDecl.(type) {
 		case *ast.GenDecl:
 			docs := DocsFromCommentGroup(decl.Doc)
+			var constType string
+			var constIota bool
 		SPEC_LOOP:
 			for _, declSpec := range decl.Specs {
 				switch ts := declSpec.(type) {
-				case *ast.ImportSpec:
-					i := ImportFromSpec(ts)
-					for _, ei := range f.eximports {
-						if ei.Match(i) {
-							continue SPEC_LOOP
-						}
-					}
-					i.oldPath = i.Path
-					for _, mi := range f.modimports {
-						i = mi.Apply(i)
-					}
-					impName := i.Name
-					if i.Name == "" {
-						impName = i.Path[strings.LastIndex(i.Path, "/")+1:]
-					}
-					f.Imports[impName] = i
 				case *ast.TypeSpec:
-					t, err := ParseExpr([]*ast.Ident{ts.Name}, docs, ts.Type)
+					specDocs := docs
+					if ts.Doc != nil {
+						specDocs = DocsFromCommentGroup(ts.Doc)
+					}
+					t, err := ParseExpr([]*ast.Ident{ts.Name}, specDocs, ts.Type)
 					if err != nil {
-						return nil, err
+						f.diagnose(SeverityError, err)
+						continue SPEC_LOOP
 					}
 					if t != nil {
-						f.Code = append(f.Code, t)
-						for _, transform := range f.trans {
-							if ok := evalTransform(transform, t, f); !ok {
-								continue SPEC_LOOP
+						m := t.meta()
+						m.TypeParams, m.Alias = TypeParamsFromFieldList(ts.TypeParams), ts.Assign.IsValid()
+						m.Comment = CommentFromCommentGroup(ts.Comment)
+						qualifyRefs(t, renames)
+						f.declare(t)
+					}
+				case *ast.ValueSpec:
+					if decl.Tok == token.CONST {
+						constType, constIota = enumConstType(ts, constType), usesIota(ts, constIota)
+						for _, name := range ts.Names {
+							if constType != "" && name.Name != "_" {
+								f.enumConsts = append(f.enumConsts, &enumConst{typeName: constType, block: decl, explicit: constIota, value: &EnumValue{
+									Name:    name.Name,
+									Docs:    DocsFromCommentGroup(ts.Doc),
+									Comment: CommentFromCommentGroup(ts.Comment),
+								}})
 							}
 						}
+					} else {
+						f.enumConsts = append(f.enumConsts, protoEnumConsts(ts)...)
 					}
-				case *ast.ValueSpec:
 					for _, gen := range f.genEnumTrans {
 						if t := gen.Generate(docs, ts); t != nil {
 							f.mkEnums = append(f.mkEnums, t)
@@ -66,8 +158,111 @@ func NewFile(file *ast.File, opts ...Option) (*File, error) {
 			}
 
 		case *ast.FuncDecl:
+			if f.protobuf {
+				f.recordOneof(decl)
+			}
 		}
 	}
+}
+
+// addImports adds the imports of file to those of f, and returns the names
+// that they were added under where they differ from their names in file. Each
+// import is renamed, e.g. v1 to v12, if another file imports another package
+// under the same name.
+func (f *File) addImports(file *ast.File) map[string]string {
+	renames := make(map[string]string)
+IMPORT_LOOP:
+	for _, spec := range file.Imports {
+		i := ImportFromSpec(spec)
+		for _, ei := range f.eximports {
+			if ei.Match(i) {
+				continue IMPORT_LOOP
+			}
+		}
+		i.oldPath = i.Path
+		for _, mi := range f.modimports {
+			i = mi.Apply(i)
+		}
+		impName := i.Name
+		if i.Name == "" {
+			impName = i.Path[strings.LastIndex(i.Path, "/")+1:]
+		}
+		name := impName
+		for n := 2; impName != "_" && impName != "."; n++ {
+			if existing, ok := f.Imports[name]; !ok || existing.oldPath == i.oldPath {
+				break
+			}
+			name = fmt.Sprintf("%s%d", impName, n)
+		}
+		if name != impName {
+			i.Name = name
+			renames[impName] = name
+		}
+		f.Imports[name] = i
+	}
+	return renames
+}
+
+// qualifyRefs renames the packages that the references in t are qualified
+// with, as given by renames.
+func qualifyRefs(t Type, renames map[string]string) {
+	if len(renames) == 0 {
+		return
+	}
+	requalify := func(expr string) string {
+		return qualifierExpr.ReplaceAllStringFunc(expr, func(sel string) string {
+			pkg, rest, _ := strings.Cut(sel, ".")
+			if name, ok := renames[pkg]; ok {
+				return name + "." + rest
+			}
+			return sel
+		})
+	}
+	refs := t.GetTypeRefs()
+	switch tt := t.(type) {
+	case *StructType:
+		for _, field := range tt.Fields {
+			qualifyRefs(field.Type, renames)
+		}
+		refs = nil
+	case *ArrayType:
+		tt.LengthExpr = requalify(tt.LengthExpr)
+	}
+	for _, tp := range t.GetTypeParams() {
+		refs = append(refs, tp.Constraint)
+	}
+	for _, ref := range refs {
+		ref.Walk(func(r *TypeRef) bool {
+			if name, ok := renames[r.Package]; ok {
+				r.Package = name
+			}
+			r.LengthExpr = requalify(r.LengthExpr)
+			return true
+		})
+	}
+}
+
+// declare adds a type declaration to the file, applying its directives and
+// then the transforms to it.
+func (f *File) declare(t Type) {
+	if t = f.applyDirectives(t); t == nil {
+		return
+	}
+	f.Code = append(f.Code, t)
+	for _, transform := range f.trans {
+		if ok := evalTransform(transform, t, f); !ok {
+			return
+		}
+	}
+}
+
+// finish completes the file once all of its declarations have been added:
+// copies fields into structs, resolves references and positions, applies
+// enum transforms and checks policies.
+func (f *File) finish() (*File, error) {
+	if f.protobuf {
+		f.protobufFields(f.Code)
+	}
 
 COPIES_LOOP:
 	for _, ci := range f.copies {
@@ -98,50 +293,79 @@ COPIES_LOOP:
 		}
 	}
 
+	resolveLengths(f.Code, f.consts)
+	if f.types != nil {
+		f.resolveTypes(f.Code)
+	}
+	f.renameRefs(f.Code)
+	f.resolveWellKnown(f.Code)
+	f.resolvePositions(f.Code)
+	f.resolveMarkers(f.Code)
+	f.resolveConstraints(f.Code)
+	f.checkRefs(f.Code)
+
+	f.promoteEnums()
 	for i, t := range f.Code {
-		switch tt := t.(type) {
-		case *StructType:
-			for _, field := range tt.Fields {
-				for _, typ := range field.GetTypeNames() {
-					if dot := strings.Index(typ, "."); dot > -1 {
-						impName := strings.Replace(typ[:dot], "*", "", -1)
-						if imp, ok := f.Imports[impName]; ok {
-							imp.used = true
-							f.Imports[impName] = imp
-						}
+		if pt, ok := t.(*PlainType); ok {
+			for _, mkEnum := range f.mkEnums {
+				if et := mkEnum.Apply(pt); et != nil {
+					if et.Comment == "" {
+						et.Comment = pt.Comment
 					}
-				}
-			}
-		default:
-			pt, ok := tt.(*PlainType)
-			if ok {
-				for _, mkEnum := range f.mkEnums {
-					if et := mkEnum.Apply(pt); et != nil {
-						f.Code[i] = et
+					if et.Pos == nil {
+						et.Pos = pt.Pos
 					}
-				}
-			}
-			for _, typ := range t.GetTypeNames() {
-				if dot := strings.Index(typ, "."); dot > -1 {
-					impName := strings.Replace(typ[:dot], "*", "", -1)
-					if imp, ok := f.Imports[impName]; ok {
-						imp.used = true
-						f.Imports[impName] = imp
+					if et.Markers == nil {
+						et.Markers = pt.Markers
+					}
+					if et.Directives == nil {
+						et.Directives = pt.Directives
 					}
+					f.Code[i] = et
 				}
 			}
 		}
 	}
 
-	for k, v := range f.Imports {
-		if !v.used {
-			delete(f.Imports, k)
-		}
+	if f.bundle {
+		f.bundleImports()
+	}
+
+	// All passes that report diagnostics have run.
+	if f.failed() {
+		return nil, f.Diagnostics
+	}
+
+	f.Imports = f.usedImports(f.Code)
+
+	if err := f.checkPolicies(f.Code, ""); err != nil {
+		return nil, err
 	}
 
 	return f, nil
 }
 
+// usedImports returns the imports of the file that code refers to.
+func (f *File) usedImports(code []Type) map[string]Import {
+	used := make(map[string]Import)
+	for _, t := range code {
+		refs := t.GetTypeRefs()
+		for _, tp := range t.GetTypeParams() {
+			refs = append(refs, tp.Constraint)
+		}
+		pkgs := refPackages(refs)
+		for _, expr := range lengthExprs(t) {
+			pkgs = append(pkgs, qualifiers(expr)...)
+		}
+		for _, impName := range pkgs {
+			if imp, ok := f.Imports[impName]; ok {
+				used[impName] = imp
+			}
+		}
+	}
+	return used
+}
+
 func evalTransform(transform Transform, t Type, f *File) bool {
 	switch tt := transform.(type) {
 	case *GenFieldTransform:
@@ -240,122 +464,364 @@ func DocsFromCommentGroup(cg *ast.CommentGroup) string {
 	return strings.Join(docs, "\n") + "\n"
 }
 
+// CommentFromCommentGroup returns a trailing comment, such as the one after a
+// field, on a single line.
+func CommentFromCommentGroup(cg *ast.CommentGroup) string {
+	if cg == nil {
+		return ""
+	}
+	var comments []string
+	for _, c := range cg.List {
+		comments = append(comments, strings.TrimSpace(c.Text))
+	}
+	return strings.Join(comments, " ")
+}
+
+// ParseExprs parses expr once for each name, for declarations that share a
+// type between several names.
+func ParseExprs(names []*ast.Ident, docs string, expr ast.Expr) ([]Type, error) {
+	typs := make([]Type, len(names))
+	for i, name := range names {
+		t, err := ParseExpr([]*ast.Ident{name}, docs, expr)
+		if err != nil {
+			return nil, err
+		}
+		typs[i] = t
+	}
+	return typs, nil
+}
+
+// ParseExpr parses expr as a type named after the first of names. Use
+// ParseExprs for a type per name. The type is positioned at the name, or at
+// expr if there is none.
 func ParseExpr(names []*ast.Ident, docs string, expr ast.Expr) (Type, error) {
 	var name string
+	pos := expr.Pos()
 	if len(names) > 0 {
 		name = names[0].Name
+		if names[0].Pos().IsValid() {
+			pos = names[0].Pos()
+		}
 	}
+	var t Type
 	switch expr := expr.(type) {
 	case *ast.Ident:
-		return PlainTypeFromIdent(name, docs, expr), nil
+		t = PlainTypeFromIdent(name, docs, expr)
 	case *ast.SelectorExpr:
-		return PlainTypeFromSelectorExpr(name, docs, expr), nil
+		t = PlainTypeFromSelectorExpr(name, docs, expr)
 	case *ast.StarExpr:
-		return PlainTypeFromStarExpr(name, docs, expr), nil
+		t = PlainTypeFromStarExpr(name, docs, expr)
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		t = PlainTypeFromInstance(name, docs, expr)
 	case *ast.ArrayType:
-		return ArrayTypeFromSpec(name, docs, expr), nil
+		t = ArrayTypeFromSpec(name, docs, expr)
 	case *ast.MapType:
-		return MapTypeFromSpec(name, docs, expr), nil
+		t = MapTypeFromSpec(name, docs, expr)
 	case *ast.StructType:
-		return StructTypeFromSpec(name, docs, expr)
+		st, err := StructTypeFromSpec(name, docs, expr)
+		if err != nil {
+			return nil, err
+		}
+		t = st
+	case *ast.FuncType:
+		t = FuncTypeFromSpec(name, docs, expr)
+	case *ast.ChanType:
+		t = ChanTypeFromSpec(name, docs, expr)
 	case *ast.InterfaceType:
-		return &PlainType{
-			Name: name,
-			Type: "interface{}",
-			Docs: docs,
-		}, nil
+		t = InterfaceTypeFromSpec(name, docs, expr)
 	default:
-		log.Printf("ParseExpr: unhandled type %T for %s\n", expr, names)
+		return nil, &parseError{code: CodeUnknownType, pos: pos, err: fmt.Errorf("unknown type %T for %s", expr, name)}
 	}
+	t.meta().Pos = &Position{pos: pos}
+	return t, nil
+}
 
-	return nil, fmt.Errorf("unknown type")
+// resolvePositions sets the line and column of the nodes in code, or clears
+// their positions if no file set was given.
+func (f *File) resolvePositions(code []Type) {
+	for _, t := range code {
+		if f.fset == nil {
+			t.meta().Pos = nil
+		} else if p := t.GetPos(); p != nil {
+			p.resolve(f.fset)
+		}
+		switch tt := t.(type) {
+		case *StructType:
+			fields := make([]Type, len(tt.Fields))
+			for i, field := range tt.Fields {
+				fields[i] = field.Type
+			}
+			f.resolvePositions(fields)
+		case *InterfaceType:
+			for _, m := range tt.Methods {
+				if f.fset == nil {
+					m.Pos = nil
+				} else if m.Pos != nil {
+					m.Pos.resolve(f.fset)
+				}
+			}
+		}
+	}
+}
+
+// checkRefs reports the type expressions in code that could not be parsed.
+func (f *File) checkRefs(code []Type) {
+	for _, t := range code {
+		if st, ok := t.(*StructType); ok {
+			fields := make([]Type, len(st.Fields))
+			for i, field := range st.Fields {
+				fields[i] = field.Type
+			}
+			f.checkRefs(fields)
+			continue
+		}
+		for _, ref := range t.GetTypeRefs() {
+			ref.Walk(func(r *TypeRef) bool {
+				if r.Kind == RefInvalid {
+					f.Diagnostics = append(f.Diagnostics, &Diagnostic{
+						Severity: SeverityWarning,
+						Code:     CodeUnhandledType,
+						Message:  fmt.Sprintf("%s: unhandled type %s", t.GetName(), r.Expr),
+						Pos:      t.GetPos(),
+					})
+				}
+				return true
+			})
+		}
+	}
 }
 
 func PlainTypeFromIdent(name, docs string, i *ast.Ident) *PlainType {
-	return &PlainType{Docs: docs, Name: name, Type: i.String()}
+	return &PlainType{Docs: docs, Name: name, Type: TypeRefFromExpr(i)}
 }
 
 func PlainTypeFromSelectorExpr(name, docs string, s *ast.SelectorExpr) *PlainType {
-	return &PlainType{Docs: docs, Name: name, Type: fmt.Sprintf("%s.%s", s.X, s.Sel)}
+	return &PlainType{Docs: docs, Name: name, Type: TypeRefFromExpr(s)}
 }
 
 func PlainTypeFromStarExpr(name, docs string, star *ast.StarExpr) *PlainType {
-	return &PlainType{Docs: docs, Name: name, Type: "*" + stringFromExpr(star.X)}
+	return &PlainType{Docs: docs, Name: name, Type: TypeRefFromExpr(star)}
+}
+
+// PlainTypeFromInstance handles an instantiated generic type such as
+// Page[User] or Pair[K, V].
+func PlainTypeFromInstance(name, docs string, e ast.Expr) *PlainType {
+	return &PlainType{Docs: docs, Name: name, Type: TypeRefFromExpr(e)}
 }
 
 func ArrayTypeFromSpec(name, docs string, a *ast.ArrayType) *ArrayType {
-	return &ArrayType{Docs: docs, Name: name, Type: stringFromExpr(a.Elt)}
+	at := &ArrayType{Docs: docs, Name: name, Type: TypeRefFromExpr(a.Elt)}
+	if a.Len != nil {
+		at.Length, at.LengthExpr = arrayLength(a.Len)
+	}
+	return at
+}
+
+// arrayLength returns the length of an array if it is a literal, or else the
+// expression for it.
+func arrayLength(e ast.Expr) (int, string) {
+	if lit, ok := e.(*ast.BasicLit); ok && lit.Kind == token.INT {
+		if n, err := strconv.ParseInt(lit.Value, 0, 0); err == nil && n > 0 {
+			return int(n), ""
+		}
+	}
+	return 0, types.ExprString(e)
 }
 
 func MapTypeFromSpec(name, docs string, m *ast.MapType) *MapType {
 	return &MapType{
 		Docs:      docs,
 		Name:      name,
-		KeyType:   stringFromExpr(m.Key),
-		ValueType: stringFromExpr(m.Value),
+		KeyType:   TypeRefFromExpr(m.Key),
+		ValueType: TypeRefFromExpr(m.Value),
 	}
 }
 
+func FuncTypeFromSpec(name, docs string, fn *ast.FuncType) *FuncType {
+	return &FuncType{
+		Docs:    docs,
+		Name:    name,
+		Params:  ParamsFromFieldList(fn.Params),
+		Results: ParamsFromFieldList(fn.Results),
+	}
+}
+
+func ChanTypeFromSpec(name, docs string, c *ast.ChanType) *ChanType {
+	return &ChanType{Docs: docs, Name: name, Type: TypeRefFromExpr(c.Value), Dir: chanDirFromAST(c.Dir)}
+}
+
+func chanDirFromAST(dir ast.ChanDir) ChanDir {
+	switch dir {
+	case ast.SEND:
+		return ChanSend
+	case ast.RECV:
+		return ChanRecv
+	}
+	return ChanBoth
+}
+
+func InterfaceTypeFromSpec(name, docs string, i *ast.InterfaceType) *InterfaceType {
+	it := &InterfaceType{Docs: docs, Name: name}
+	for _, f := range i.Methods.List {
+		fn, ok := f.Type.(*ast.FuncType)
+		if !ok || len(f.Names) == 0 {
+			it.Embeds = append(it.Embeds, TypeRefFromExpr(f.Type))
+			continue
+		}
+		for _, name := range f.Names {
+			it.Methods = append(it.Methods, &Method{
+				Docs:    DocsFromCommentGroup(f.Doc),
+				Comment: CommentFromCommentGroup(f.Comment),
+				Pos:     &Position{pos: name.Pos()},
+				Name:    name.Name,
+				Params:  ParamsFromFieldList(fn.Params),
+				Results: ParamsFromFieldList(fn.Results),
+			})
+		}
+	}
+	return it
+}
+
+func ParamsFromFieldList(fl *ast.FieldList) []*Param {
+	if fl == nil {
+		return nil
+	}
+	var params []*Param
+	for _, f := range fl.List {
+		typ, variadic := f.Type, false
+		if e, ok := typ.(*ast.Ellipsis); ok {
+			typ, variadic = e.Elt, true
+		}
+		if len(f.Names) == 0 {
+			params = append(params, &Param{Type: TypeRefFromExpr(typ), Variadic: variadic})
+		}
+		for _, name := range f.Names {
+			params = append(params, &Param{Name: name.Name, Type: TypeRefFromExpr(typ), Variadic: variadic})
+		}
+	}
+	return params
+}
+
 func StructTypeFromSpec(name, docs string, s *ast.StructType) (*StructType, error) {
 	st := &StructType{
 		Docs: docs,
 		Name: name,
 	}
 
-FIELD_LOOP:
 	for _, f := range s.Fields.List {
-		field, err := FieldFromSpec(f)
+		fields, err := FieldsFromSpec(f)
 		if err != nil {
 			return nil, err
 		}
-		if field.Type == nil {
-			continue FIELD_LOOP
+		for _, field := range fields {
+			if field.Type != nil {
+				st.Fields = append(st.Fields, field)
+			}
 		}
-		st.Fields = append(st.Fields, field)
 	}
 
 	return st, nil
 }
 
+// FieldFromSpec returns the field of the first name in f. Use FieldsFromSpec
+// for declarations of several fields, such as "X, Y, Z float64".
 func FieldFromSpec(f *ast.Field) (*Field, error) {
+	fields, err := FieldsFromSpec(f)
+	if err != nil {
+		return nil, err
+	}
+	return fields[0], nil
+}
+
+// FieldsFromSpec returns a field for each name in f, so that "X, Y, Z float64"
+// yields three fields with the same type, docs and tags.
+func FieldsFromSpec(f *ast.Field) ([]*Field, error) {
 	docs := DocsFromCommentGroup(f.Doc)
-	typ, err := ParseExpr(f.Names, docs, f.Type)
+	names := f.Names
+	if len(names) == 0 {
+		names = []*ast.Ident{ast.NewIdent(embeddedName(f.Type))}
+	}
+	typs, err := ParseExprs(names, docs, f.Type)
 	if err != nil {
 		return nil, err
 	}
-	field := &Field{
-		Type: typ,
+	fields := make([]*Field, len(typs))
+	for i, typ := range typs {
+		typ.meta().Comment = CommentFromCommentGroup(f.Comment)
+		field := &Field{
+			Type:     typ,
+			Tags:     &structtag.Tags{},
+			Embedded: len(f.Names) == 0,
+		}
+		if f.Tag != nil {
+			tags, err := structtag.Parse(f.Tag.Value[1 : len(f.Tag.Value)-1])
+			if err != nil {
+				return nil, &parseError{code: CodeBadTag, pos: f.Tag.Pos(), err: fmt.Errorf("%w: %s", err, f.Tag.Value)}
+			}
+			field.Tags = tags
+		}
+		fields[i] = field
 	}
-	if f.Tag != nil {
-		tags, err := structtag.Parse(f.Tag.Value[1 : len(f.Tag.Value)-1])
-		if err != nil {
-			return nil, fmt.Errorf("%w: %s", err, f.Tag.Value)
+	return fields, nil
+}
+
+func TypeParamsFromFieldList(fl *ast.FieldList) []*TypeParam {
+	if fl == nil {
+		return nil
+	}
+	var tps []*TypeParam
+	for _, f := range fl.List {
+		for _, name := range f.Names {
+			tps = append(tps, &TypeParam{Name: name.Name, Constraint: TypeRefFromExpr(f.Type)})
 		}
-		field.Tags = tags
 	}
-	return field, nil
+	return tps
+}
+
+var qualifierExpr = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_]*)\.[A-Za-z_]`)
+
+// qualifiers returns the package names referenced by an expression, e.g.
+// ["pkg"] for the array length "pkg.Size".
+func qualifiers(typ string) []string {
+	var pkgs []string
+	for _, m := range qualifierExpr.FindAllStringSubmatch(typ, -1) {
+		pkgs = append(pkgs, m[1])
+	}
+	return pkgs
 }
 
-func stringFromExpr(e ast.Expr) string {
+// lengthExprs returns the unevaluated array lengths in t, which may refer to
+// imported constants.
+func lengthExprs(t Type) []string {
+	switch tt := t.(type) {
+	case *ArrayType:
+		if tt.LengthExpr != "" {
+			return []string{tt.LengthExpr}
+		}
+	case *StructType:
+		var exprs []string
+		for _, field := range tt.Fields {
+			exprs = append(exprs, lengthExprs(field.Type)...)
+		}
+		return exprs
+	}
+	return nil
+}
+
+// embeddedName returns the name of an embedded field, which is the name of its
+// type without package qualifier, pointer or type arguments.
+func embeddedName(e ast.Expr) string {
 	switch t := e.(type) {
 	case *ast.Ident:
-		return t.String()
+		return t.Name
 	case *ast.SelectorExpr:
-		return fmt.Sprintf("%s.%s", t.X, t.Sel)
+		return t.Sel.Name
 	case *ast.StarExpr:
-		return fmt.Sprintf("*%s", stringFromExpr(t.X))
-	case *ast.ArrayType:
-		return fmt.Sprintf("[]%s", stringFromExpr(t.Elt))
-	case *ast.MapType:
-		return fmt.Sprintf("map[%s]%s", stringFromExpr(t.Key), stringFromExpr(t.Value))
-	case *ast.InterfaceType:
-		return "interface{}"
-	case *ast.StructType:
-		return "struct{}"
-	case *ast.FuncType:
-		return "func()"
-	default:
-		log.Printf("stringFromExpr: unhandled type %T for %v\n", t, e)
-		return ""
+		return embeddedName(t.X)
+	case *ast.IndexExpr:
+		return embeddedName(t.X)
+	case *ast.IndexListExpr:
+		return embeddedName(t.X)
 	}
+	return ""
 }
@@ -1,13 +1,20 @@
 package toast
 
 import (
+	"errors"
 	"fmt"
+	"go/ast"
 	"go/parser"
 	"go/token"
+	htmltemplate "html/template"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"text/template"
+	"time"
 )
 
 func TestGoFileFromAST(t *testing.T) {
@@ -41,7 +48,7 @@ func load(t *testing.T, path, output string) {
 		t.Fatal(err)
 	}
 
-	f, _ := NewFile(astFile, WithCUEPackageName("mockcue"))
+	f, _ := NewFile(astFile, WithFileSet(fset), WithCUEPackageName("mockcue"))
 	// f.debug = true
 
 	outputPath := path[strings.LastIndex(path, "/")+1:]
@@ -60,3 +67,1195 @@ func load(t *testing.T, path, output string) {
 		panic(err)
 	}
 }
+
+func parseSource(t *testing.T, src string, opts ...Option) *File {
+	t.Helper()
+	astFile, err := parser.ParseFile(token.NewFileSet(), "src.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(astFile, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func assertContains(t *testing.T, out string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		if !strings.Contains(out, w) {
+			t.Errorf("output does not contain %q:\n%s", w, out)
+		}
+	}
+}
+
+func TestGenerics(t *testing.T) {
+	f := parseSource(t, `package p
+
+import "example.com/users"
+
+type Page[T any] struct {
+	Items []T `+"`json:\"items\"`"+`
+}
+
+type Users struct {
+	Page Page[users.User] `+"`json:\"page\"`"+`
+}
+`)
+	if _, ok := f.Imports["users"]; !ok {
+		t.Error("import referenced by a type argument was dropped")
+	}
+	assertContains(t, f.Go(), "type Page[T any] struct", "Page Page[users.User]")
+	assertContains(t, f.CUE(), "#Page: {\nitems: [..._]", "page: #Page_users_User", "#Page_users_User: {\nitems: [...users.#User]")
+	assertContains(t, string(f.Reflect()), `"type_params":[{"name":"T","constraint":{"kind":"named","name":"any"}}]`)
+}
+
+func TestFuncType(t *testing.T) {
+	src := `package p
+
+import "context"
+
+type Handler func(ctx context.Context, args ...string) (n int, err error)
+
+type Hooks struct {
+	OnEvent func(string) error ` + "`json:\"onEvent\"`" + `
+	Handler Handler            ` + "`json:\"handler\"`" + `
+	Name    string             ` + "`json:\"name\"`" + `
+}
+`
+	f := parseSource(t, src)
+	assertContains(t, f.Go(),
+		"type Handler func(ctx context.Context, args ...string) (n int, err error)",
+		"OnEvent func(string) error",
+	)
+	assertContains(t, f.CUE(), "#Handler: _", "onEvent: _")
+	assertContains(t, string(f.Reflect()), `"kind":"func","name":"Handler"`, `{"name":"args","type":{"kind":"named","name":"string"},"variadic":true}`)
+
+	f = parseSource(t, src, WithFuncPolicy(PolicySkip))
+	if out := f.CUE(); strings.Contains(out, "andler") || strings.Contains(out, "onEvent") {
+		t.Errorf("skipped function types rendered in CUE:\n%s", out)
+	}
+
+	astFile, _ := parser.ParseFile(token.NewFileSet(), "src.go", src, 0)
+	if _, err := NewFile(astFile, WithFuncPolicy(PolicyError)); err == nil {
+		t.Error("expected an error for function types")
+	}
+
+	// Mutually recursive types are only followed once.
+	f = parseSource(t, `package p
+
+type Tree map[string]Forest
+
+type Forest []Tree
+
+type Visit func(Path) Path
+
+type Path []Visit
+`, WithFuncPolicy(PolicySkip))
+	assertContains(t, f.CUE(), "#Tree: [string]: #Forest", "#Forest: [...#Tree]")
+	if out := f.CUE(); strings.Contains(out, "Path") {
+		t.Errorf("types referring to skipped function types rendered in CUE:\n%s", out)
+	}
+}
+
+func TestChanType(t *testing.T) {
+	src := `package p
+
+type Events <-chan []Event
+
+type Worker struct {
+	Name string     ` + "`json:\"name\"`" + `
+	Done chan<- int ` + "`json:\"done\"`" + `
+}
+`
+	f := parseSource(t, src)
+	assertContains(t, f.Go(), "type Events <-chan []Event", "Done chan<- int")
+	if out := f.CUE(); strings.Contains(out, "Events") || strings.Contains(out, "done") {
+		t.Errorf("channel types rendered in CUE by default:\n%s", out)
+	}
+
+	f = parseSource(t, src, WithChanPolicy(PolicyTop))
+	assertContains(t, f.CUE(), "#Events: _", "done: _")
+	assertContains(t, string(f.Reflect()), `{"kind":"chan","name":"Events","type":{"kind":"slice","elem":{"kind":"named","name":"Event"}},"dir":"recv"}`)
+}
+
+func TestInterfaceType(t *testing.T) {
+	f := parseSource(t, `package p
+
+import "context"
+
+// Service does things.
+type Service interface {
+	Named
+
+	// Get gets a thing.
+	Get(ctx context.Context, name string) (string, error)
+}
+`)
+	assertContains(t, f.Go(), "type Service interface {\n\tNamed\n\n\t// Get gets a thing.\n\tGet(ctx context.Context, name string) (string, error)\n}")
+	assertContains(t, f.CUE(), "#Service: _")
+	assertContains(t, string(f.Reflect()),
+		`"kind":"interface","name":"Service","methods":[{"name":"Get","params":[{"name":"ctx","type":{"kind":"named","package":"context","name":"Context"}},{"name":"name","type":{"kind":"named","name":"string"}}],"results":[{"type":{"kind":"named","name":"string"}},{"type":{"kind":"named","name":"error"}}],"docs":"// Get gets a thing.\n"}],"embeds":[{"kind":"named","name":"Named"}]`,
+	)
+}
+
+func TestEmbeddedField(t *testing.T) {
+	f := parseSource(t, `package p
+
+import (
+	"bytes"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type Name string
+
+type Pod struct {
+	metav1.TypeMeta `+"`json:\",inline\"`"+`
+	*Spec
+	Name
+	Meta metav1.ObjectMeta `+"`json:\"metadata,omitempty\"`"+`
+	*bytes.Buffer `+"`json:\"-\"`"+`
+}
+
+type Spec struct {
+	Image string `+"`json:\"image\"`"+`
+}
+`)
+	st := f.Code[1].(*StructType)
+	if !st.Fields[0].Embedded || st.Fields[0].GetName() != "TypeMeta" {
+		t.Errorf("embedded field not recognised: %s", st.Fields[0].Reflect())
+	}
+	assertContains(t, f.Go(), "\tmetav1.TypeMeta `json:\",inline\"`\n", "\t*Spec\n", "\tName\n", "`json:\"metadata,omitempty\"`")
+	assertContains(t, f.CUE(), "#Pod: {\nmetav1.#TypeMeta\n#Spec\nName: #Name\nmetadata?: metav1.#ObjectMeta\n}")
+	assertContains(t, f.Go(), "\t*bytes.Buffer `json:\"-\"`\n")
+	assertContains(t, string(st.Reflect()), `"name":"TypeMeta","type":{"kind":"named","package":"metav1","name":"TypeMeta"},"embedded":true`)
+}
+
+func TestMultiNameFields(t *testing.T) {
+	f := parseSource(t, `package p
+
+type Point struct {
+	// coordinate
+	X, Y, Z float64 `+"`json:\"coord,omitempty\"`"+`
+}
+`)
+	st := f.Code[0].(*StructType)
+	if len(st.Fields) != 3 {
+		t.Fatalf("expected 3 fields, got %d", len(st.Fields))
+	}
+	for i, name := range []string{"X", "Y", "Z"} {
+		field := st.Fields[i]
+		if field.GetName() != name || field.GetDocs() != "// coordinate\n" || field.tag("json").Name != "coord" {
+			t.Errorf("unexpected field %d: %s", i, field.Reflect())
+		}
+	}
+	assertContains(t, f.Go(), "X float64 `json:\"coord,omitempty\"`", "Z float64 `json:\"coord,omitempty\"`")
+
+	expr, err := parser.ParseExpr("struct{ X, Y int }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	field, err := FieldFromSpec(expr.(*ast.StructType).Fields.List[0])
+	if err != nil || field.GetName() != "X" {
+		t.Errorf("FieldFromSpec returned %v, %v", field, err)
+	}
+}
+
+func TestArrayLength(t *testing.T) {
+	f := parseSource(t, `package p
+
+import "crypto/sha256"
+
+const size = 1 << 3
+
+type Key [size * 2]byte
+
+type Sum [sha256.Size]byte
+
+type Keys struct {
+	IDs [4]string `+"`json:\"ids\"`"+`
+}
+`)
+	key, sum := f.Code[0].(*ArrayType), f.Code[1].(*ArrayType)
+	if key.Length != 16 || key.LengthExpr != "" {
+		t.Errorf("local constant length not evaluated: %s", key.Reflect())
+	}
+	if sum.Length != 0 || sum.LengthExpr != "sha256.Size" {
+		t.Errorf("imported constant length not kept: %s", sum.Reflect())
+	}
+	if _, ok := f.Imports["sha256"]; !ok {
+		t.Error("import referenced by an array length was dropped")
+	}
+	assertContains(t, f.Go(), "type Key [16]byte", "type Sum [sha256.Size]byte", "IDs [4]string")
+	assertContains(t, f.CUE(), `"list"`, "#Key: list.MinItems(16) & list.MaxItems(16) & [...byte]", "ids: list.MinItems(4) & list.MaxItems(4) & [...string]")
+	assertContains(t, string(key.Reflect()), `"length":16,"min_items":16,"max_items":16`)
+}
+
+func TestAlias(t *testing.T) {
+	src := `package p
+
+type ID = string
+
+type IDs = []ID
+
+type Name string
+
+type User struct {
+	ID   ID   ` + "`json:\"id\"`" + `
+	IDs  IDs  ` + "`json:\"ids\"`" + `
+	Name Name ` + "`json:\"name\"`" + `
+}
+`
+	f := parseSource(t, src)
+	if !f.Code[0].IsAlias() || !f.Code[1].IsAlias() || f.Code[2].IsAlias() {
+		t.Error("aliases not distinguished from defined types")
+	}
+	assertContains(t, f.Go(), "type ID = string", "type IDs = []ID", "type Name string")
+	assertContains(t, f.CUE(), "#ID: string", "id: #ID")
+	assertContains(t, string(f.Reflect()), `{"kind":"plain","name":"ID","type":{"kind":"named","name":"string"},"alias":true}`)
+
+	out := parseSource(t, src, WithCUEInlineAliases()).CUE()
+	assertContains(t, out, "id: string", "ids: [...string]", "name: #Name")
+	if strings.Contains(out, "#ID") {
+		t.Errorf("inlined alias rendered as a definition:\n%s", out)
+	}
+}
+
+func TestTypeRef(t *testing.T) {
+	f := parseSource(t, `package p
+
+import "example.com/users"
+
+type Index map[string]map[string][]*users.User
+
+type Lists struct {
+	Tags  *[]string                           `+"`json:\"tags\"`"+`
+	Pages map[string]users.Page[users.User] `+"`json:\"pages\"`"+`
+}
+`)
+	idx := f.Code[0].(*MapType)
+	if ref := idx.ValueType.Value.Elem; idx.ValueType.Kind != RefMap || ref == nil || ref.Package != "users" || !ref.Pointer {
+		t.Errorf("nested map not parsed: %s", idx.Reflect())
+	}
+	assertContains(t, f.Go(), "type Index map[string]map[string][]*users.User", "*[]string", "map[string]users.Page[users.User]")
+	assertContains(t, f.CUE(), "#Index: [string]: {[string]: [...users.#User]}", "tags: [...string]", "pages: [string]: users.#Page_users_User")
+}
+
+func TestComments(t *testing.T) {
+	f := parseSource(t, `package p
+
+type (
+	// Status is documented.
+	Status string
+
+	Code int // trailing
+)
+
+type Reply struct {
+	Status Status `+"`json:\"status\"`"+` // current status
+	Code   Code   // no tag
+}
+
+type Service interface {
+	Get() error // gets
+}
+`)
+	status, code := f.Code[0], f.Code[1]
+	if status.GetDocs() != "// Status is documented.\n" || code.GetDocs() != "" {
+		t.Errorf("grouped spec docs not read per spec: %q, %q", status.GetDocs(), code.GetDocs())
+	}
+	if Description(status) != "Status is documented." || Description(code) != "trailing" {
+		t.Errorf("unexpected descriptions: %q, %q", Description(status), Description(code))
+	}
+	assertContains(t, f.Go(), "type Code int // trailing", "Status Status `json:\"status\"` // current status", "Code   Code   // no tag", "Get() error // gets")
+	assertContains(t, f.CUE(), "#Code: int // trailing", "status: #Status // current status")
+	assertContains(t, string(f.Reflect()), `"name":"Code","type":{"kind":"named","name":"int"},"comment":"// trailing"`)
+}
+
+func TestPositions(t *testing.T) {
+	src := `package p
+
+type Hooks struct {
+	Name    string       ` + "`json:\"name\"`" + `
+	OnEvent func() error ` + "`json:\"onEvent\"`" + `
+}
+`
+	fset := token.NewFileSet()
+	astFile, err := parser.ParseFile(fset, "hooks.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(astFile, WithFileSet(fset))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := f.Code[0].(*StructType)
+	if pos := st.Fields[1].GetPos().String(); pos != "hooks.go:5:2" {
+		t.Errorf("unexpected field position %s", pos)
+	}
+	assertContains(t, string(f.Reflect()), `"name":"Hooks","fields":[`, `"pos":"hooks.go:3:6"`, `"name":"Name","type":{"kind":"named","name":"string"},"pos":"hooks.go:4:2"`)
+
+	_, err = NewFile(astFile, WithFileSet(fset), WithFuncPolicy(PolicyError))
+	if err == nil || err.Error() != "hooks.go:5:2: Hooks.OnEvent: func types are not supported" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	astFile, _ = parser.ParseFile(fset, "tags.go", "package p\n\ntype T struct {\n\tX int `json:\"x`\n}\n", 0)
+	if _, err = NewFile(astFile, WithFileSet(fset)); err == nil || !strings.HasPrefix(err.Error(), "tags.go:4:8: ") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	f = parseSource(t, src)
+	if strings.Contains(string(f.Reflect()), `"pos"`) {
+		t.Errorf("positions rendered without a file set: %s", f.Reflect())
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	parse := func(src string, opts ...Option) (*File, error) {
+		fset := token.NewFileSet()
+		astFile, err := parser.ParseFile(fset, "src.go", src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// A map value that is not a type, which the parser does not produce
+		// but go/ast allows.
+		odd := astFile.Decls[len(astFile.Decls)-1].(*ast.GenDecl).Specs[0].(*ast.TypeSpec)
+		odd.Type.(*ast.MapType).Value = &ast.BasicLit{Kind: token.INT, Value: "1"}
+		return NewFile(astFile, append(opts, WithFileSet(fset))...)
+	}
+	good := "package p\n\ntype Good struct {\n\tX int `json:\"x\"`\n}\n\n"
+	bad := "type Bad struct {\n\tY int `json:\"y`\n}\n\n"
+	odd := "type Odd map[string]int\n"
+
+	_, err := parse(good + bad + odd)
+	var diags Diagnostics
+	if !errors.As(err, &diags) || len(diags) != 2 || diags[0].Code != CodeBadTag || diags[1].Code != CodeUnhandledType {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diags[0].String() != "src.go:8:8: error: bad syntax for struct tag value: `json:\"y`" {
+		t.Errorf("unexpected diagnostic: %s", diags[0])
+	}
+
+	f, err := parse(good+bad+odd, WithLenient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Code) != 2 || f.Code[0].GetName() != "Good" || f.Code[1].GetName() != "Odd" {
+		t.Errorf("bad declaration not left out: %s", f.Reflect())
+	}
+	assertContains(t, f.Diagnostics.Error(), "src.go:11:6: warning: Odd: unhandled type 1")
+
+	if _, err := parse(good + odd); err != nil {
+		t.Errorf("warning failed by default: %v", err)
+	}
+	if _, err := parse(good+odd, WithStrict()); err == nil {
+		t.Error("warning did not fail in strict mode")
+	}
+
+	// Warnings reported once enums are promoted fail in strict mode too.
+	astFile, err := parser.ParseFile(token.NewFileSet(), "src.go", "package p\n\n//toast:enum\ntype P string\n", parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFile(astFile, WithStrict()); !errors.As(err, &diags) || diags[0].Code != CodeBadDirective {
+		t.Errorf("bad directive did not fail in strict mode: %v", err)
+	}
+}
+
+func TestPackage(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"base.go": `package p
+
+import "time"
+
+type Base struct {
+	Created time.Time ` + "`json:\"created\"`" + `
+}
+
+type Page[T any] struct {
+	Items []T ` + "`json:\"items\"`" + `
+}
+`,
+		"user.go": `package p
+
+type User struct {
+	Base  Base       ` + "`json:\"base\"`" + `
+	Name  string     ` + "`json:\"name\"`" + `
+	Posts Page[Post] ` + "`json:\"posts\"`" + `
+}
+
+type Post string
+`,
+		"user_test.go": "package p_test\n",
+		"gen.go":       "//go:build ignore\n\npackage main\n",
+		"os_plan9.go":  "package p\n\ntype OS struct{}\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := NewPackage(dir, WithTransform(&CopyIntoStruct{
+		StructName:     "User",
+		FieldToReplace: "Base",
+		FromStructs:    map[string]struct{}{"Base": {}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.Imports["time"]; !ok {
+		t.Error("import used by a field copied from another file was dropped")
+	}
+	assertContains(t, f.Go(), "type User struct {\n\tCreated time.Time")
+
+	split := f.Split()
+	if len(split) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(split))
+	}
+	user := split[filepath.Join(dir, "user.go")]
+	if len(user.Code) != 2 || user.Imports["time"].Path != "time" {
+		t.Errorf("unexpected declarations or imports: %s", user.Reflect())
+	}
+	assertContains(t, user.CUE(), "posts: #Page_Post", "#Page_Post: {\nitems: [...#Post]")
+	if base := split[filepath.Join(dir, "base.go")].CUE(); strings.Contains(base, "#User") {
+		t.Errorf("declaration rendered in the wrong file:\n%s", base)
+	}
+
+	// Each file qualifies references with its own imports.
+	fset := token.NewFileSet()
+	var astFiles []*ast.File
+	for _, src := range []string{
+		"package p\n\nimport v1 \"k8s.io/api/core/v1\"\n\ntype Pod struct {\n\tSpec v1.PodSpec `json:\"spec\"`\n}\n",
+		"package p\n\nimport \"k8s.io/api/apps/v1\"\n\ntype Deployment struct {\n\tSpec v1.DeploymentSpec `json:\"spec\"`\n}\n",
+	} {
+		astFile, err := parser.ParseFile(fset, "", src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		astFiles = append(astFiles, astFile)
+	}
+	f, err = NewPackageFromFiles(astFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Imports["v1"].Path != "k8s.io/api/core/v1" || f.Imports["v12"].Path != "k8s.io/api/apps/v1" {
+		t.Errorf("unexpected imports: %s", f.Reflect())
+	}
+	assertContains(t, f.Go(), "v12 \"k8s.io/api/apps/v1\"", "Spec v1.PodSpec", "Spec v12.DeploymentSpec")
+}
+
+func TestLoadPackage(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/p\n\ngo 1.22\n",
+		"p.go": `package p
+
+import (
+	"bytes"
+	"time"
+)
+
+type Config struct {
+	Timeout time.Duration ` + "`json:\"timeout\"`" + `
+	Buf     bytes.Buffer  ` + "`json:\"buf\"`" + `
+	Level   Level         ` + "`json:\"level\"`" + `
+}
+
+type Level uint8
+`,
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := LoadPackage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertContains(t, string(f.Reflect()),
+		`"type":{"kind":"named","package":"time","path":"time","name":"Duration","underlying":{"kind":"named","name":"int64"}}`,
+		`"type":{"kind":"named","path":"example.com/p","name":"Level","underlying":{"kind":"named","name":"uint8"}}`,
+		`"underlying":{"kind":"struct","expr":"struct{`,
+	)
+	out := f.CUE()
+	assertContains(t, out, "timeout: int64", "buf: bytes.#Buffer", "level: #Level")
+	if strings.Contains(out, `"time"`) {
+		t.Errorf("unused import rendered in CUE:\n%s", out)
+	}
+}
+
+func TestBundle(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"meta/meta.go": `package meta
+
+import (
+	"text/template"
+	"time"
+)
+
+type Object struct {
+	Name     string             ` + "`json:\"name\"`" + `
+	Labels   Labels             ` + "`json:\"labels\"`" + `
+	Created  time.Time          ` + "`json:\"created\"`" + `
+	Template *template.Template ` + "`json:\"-\"`" + `
+}
+
+type Labels map[string]string
+`,
+		"api/api.go": `package api
+
+import (
+	"html/template"
+
+	"example.com/m/meta"
+)
+
+type Pod struct {
+	meta.Object
+	Image string             ` + "`json:\"image\"`" + `
+	Page  *template.Template ` + "`json:\"-\"`" + `
+}
+`,
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := NewPackage(filepath.Join(dir, "api"), WithBundle())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Diagnostics) > 0 {
+		t.Errorf("unexpected diagnostics: %s", f.Diagnostics)
+	}
+	if _, ok := f.Imports["meta"]; ok {
+		t.Error("import of a bundled package kept")
+	}
+	if _, ok := f.Imports["time"]; !ok {
+		t.Error("import used by a bundled type dropped")
+	}
+	assertContains(t, f.Go(), "type Pod struct {\n\tmeta_Object\n", "type meta_Object struct", "Labels   meta_Labels", "type meta_Labels map[string]string",
+		"\t\"html/template\"\n", "\ttemplate2 \"text/template\"\n", "Page  *template.Template", "Template *template2.Template")
+	assertContains(t, f.CUE(), "#Pod: {\n#meta_Object\n", "#meta_Object: {", "labels: #meta_Labels", "created: time.#Time")
+}
+
+func TestEnums(t *testing.T) {
+	f := parseSource(t, `package p
+
+// Color is a color.
+type Color int
+
+const (
+	// Red is the first color.
+	Red Color = iota
+	Green // second
+	_
+	Blue
+)
+
+type Kind string
+
+const (
+	KindPod     Kind = "pod"
+	KindService Kind = "service"
+)
+
+type Plain int
+
+const Untyped = 1
+
+type Port int
+
+const DefaultPort Port = 8080
+
+type Size int
+
+const MinSize Size = 1
+
+const MaxSize Size = 10
+
+type Server struct {
+	Port Port `+"`json:\"port\"`"+`
+	Size Size `+"`json:\"size\"`"+`
+}
+`)
+	colors, ok := f.Code[0].(*EnumType)
+	if !ok {
+		t.Fatalf("got %T, want *EnumType", f.Code[0])
+	}
+	var names []string
+	for _, v := range colors.Values {
+		names = append(names, v.Name+"="+v.Value.ExactString())
+	}
+	if want := []string{"Red=0", "Green=1", "Blue=3"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got values %v, want %v", names, want)
+	}
+	if colors.Values[0].Docs != "// Red is the first color.\n" || colors.Values[1].Comment != "// second" {
+		t.Errorf("got docs %q and comment %q", colors.Values[0].Docs, colors.Values[1].Comment)
+	}
+	if _, ok := f.Code[2].(*PlainType); !ok {
+		t.Errorf("got %T for a type without constants, want *PlainType", f.Code[2])
+	}
+	assertContains(t, f.Go(), "type Color int", "Red   Color = 0", "Green Color = 1 // second", "type Kind string", "KindPod     Kind = \"pod\"")
+	assertContains(t, f.CUE(), "#Color: 0 | 1 | 3", "#Kind: \"pod\" | \"service\"", "Green: 1 // second")
+	// Constants declared one at a time, such as defaults, leave their
+	// type open.
+	assertContains(t, f.CUE(), "#Port: int\n", "#Size: int\n", "port: #Port\nsize: #Size\n")
+	assertContains(t, string(f.Reflect()), `"type":{"kind":"named","name":"int"}`, `{"name":"Red","value":0,"docs":"// Red is the first color.\n"}`, `{"name":"KindPod","value":"pod"}`)
+
+	// Enums promoted with a transform keep their untyped constants.
+	f = parseSource(t, `package p
+
+type Mode string
+
+var modes = []string{"A", "B"}
+`, WithTransform(&GenEnumTypeTransform{
+		Generate: func(docs string, spec *ast.ValueSpec) *PromoteToEnumType {
+			return &PromoteToEnumType{Apply: func(pt *PlainType) *EnumType {
+				return &EnumType{Name: pt.Name, Values: []*EnumValue{{Name: "A"}, {Name: "B"}}}
+			}}
+		},
+	}))
+	assertContains(t, f.Go(), "type Mode string", "\tMode_A = \"A\"\n")
+	assertContains(t, f.CUE(), "#Mode: \"A\" | \"B\"", "Mode_B: \"B\"\n")
+}
+
+func TestConstExprs(t *testing.T) {
+	src := `package p
+
+type R float64
+
+type Color int
+
+const (
+	N     = len("abc") + 1
+	Shift = 1.0 << 3
+	Half  R = R(1) / 2
+	Third = int(7) / 2
+	Bad   = "a" + 1
+	Less  = "a" < 1
+	Blue  Color = Color(2.0)
+	Char  = string(65)
+)
+`
+	astFile, err := parser.ParseFile(token.NewFileSet(), "src.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	consts := ConstsFromDecls(astFile.Decls)
+	got := make(map[string]string)
+	for name, v := range consts {
+		got[name] = v.String()
+	}
+	want := map[string]string{"Shift": "8", "Half": "0.5", "Third": "3", "Blue": "2", "Char": `"A"`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got constants %v, want %v", got, want)
+	}
+	parseSource(t, src)
+}
+
+func TestProtoEnums(t *testing.T) {
+	f := parseSource(t, `package p
+
+// Status is generated by protoc-gen-go.
+type Status int32
+
+var (
+	Status_name = map[int32]string{
+		0:  "UNKNOWN",
+		1:  "ACTIVE",
+		-1: "DELETED",
+	}
+	Status_value = map[string]int32{
+		"UNKNOWN": 0,
+		"ACTIVE":  1,
+		"DELETED": -1,
+	}
+)
+
+type Other int32
+
+var Other_labels = map[int32]string{0: "ZERO"}
+`)
+	status, ok := f.Code[0].(*EnumType)
+	if !ok {
+		t.Fatalf("got %T, want *EnumType", f.Code[0])
+	}
+	var names []string
+	for _, v := range status.Values {
+		names = append(names, v.Name+"="+v.Value.ExactString())
+	}
+	if want := []string{"Status_UNKNOWN=0", "Status_ACTIVE=1", "Status_DELETED=-1"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got values %v, want %v", names, want)
+	}
+	if _, ok := f.Code[1].(*PlainType); !ok {
+		t.Errorf("got %T for a type without value maps, want *PlainType", f.Code[1])
+	}
+	assertContains(t, f.Go(), "type Status int32", "Status_DELETED Status = -1")
+	assertContains(t, f.CUE(), "#Status: 0 | 1 | -1")
+}
+
+func TestProtobuf(t *testing.T) {
+	fset := token.NewFileSet()
+	astFile, err := parser.ParseFile(fset, "testdata/protobuf.go", nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(astFile, WithFileSet(fset), WithProtobuf())
+	if err != nil {
+		t.Fatal(err)
+	}
+	route := f.Code[0].(*StructType)
+	var names []string
+	for _, field := range route.Fields {
+		names = append(names, field.GetName())
+	}
+	if want := []string{"Name", "MaxRetries", "Timeout", "Action"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got fields %v, want %v", names, want)
+	}
+	if _, ok := f.Imports["protoimpl"]; ok {
+		t.Error("import of internal fields kept")
+	}
+	assertContains(t, f.CUE(),
+		"#Route: {\n// The name of the route.\nname?: string\nmaxRetries?: uint32\n",
+		"{} | #Route_Cluster | #Route_Redirect\n}",
+		"#Route_Cluster: {\n// The cluster to route to.\ncluster: string\n}",
+		"redirectUrl: string",
+	)
+	assertContains(t, string(f.Reflect()), `"one_of":[{"kind":"named","name":"Route_Cluster"},{"kind":"named","name":"Route_Redirect"}]`, `"tags":{"protobuf":"varint","json":"maxRetries"}`)
+	// Go output keeps the tags as generated.
+	out := f.Go()
+	assertContains(t, out, "`protobuf:\"varint,2,opt,name=max_retries,json=maxRetries,proto3\" json:\"max_retries,omitempty\"`",
+		"Cluster string `protobuf:\"bytes,4,opt,name=cluster,proto3,oneof\"`\n")
+	if strings.Contains(out, "json:\"maxRetries") || strings.Contains(out, "json:\"redirectUrl\"") {
+		t.Errorf("protojson names leak into the Go output:\n%s", out)
+	}
+}
+
+func TestWellKnownTypes(t *testing.T) {
+	f := parseSource(t, `package p
+
+import (
+	"time"
+
+	anypb "google.golang.org/protobuf/types/known/anypb"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	wrapperspb "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type Config struct {
+	Timeout  *durationpb.Duration   `+"`json:\"timeout\"`"+`
+	Created  *timestamppb.Timestamp `+"`json:\"created\"`"+`
+	Metadata *structpb.Struct       `+"`json:\"metadata\"`"+`
+	Extra    []*anypb.Any           `+"`json:\"extra\"`"+`
+	Retries  *wrapperspb.UInt32Value `+"`json:\"retries\"`"+`
+	Updated  time.Time              `+"`json:\"updated\"`"+`
+}
+`)
+	out := f.CUE()
+	assertContains(t, out,
+		"import (\n  \"time\"\n)",
+		`timeout: =~"^-?[0-9]+(\\.[0-9]+)?s$"`,
+		"created: time.Time",
+		"metadata: {...}",
+		`extra: [...{"@type": string, ...}]`,
+		"retries: null | uint32",
+		"updated: time.#Time",
+	)
+	if strings.Contains(out, "pb\"") {
+		t.Errorf("unused imports of well-known types kept:\n%s", out)
+	}
+	assertContains(t, string(f.Reflect()), `"path":"google.golang.org/protobuf/types/known/durationpb","name":"Duration","well_known":"duration"`)
+}
+
+func TestEncodingJSON(t *testing.T) {
+	src := `package p
+
+type Base struct {
+	ID string
+}
+
+type Config struct {
+	Base
+	Name     string
+	Count    int64   ` + "`json:\"count,string\"`" + `
+	Ratio    float64 ` + "`json:\",string,omitempty\"`" + `
+	Enabled  bool    ` + "`json:\"enabled,string\"`" + `
+	Secret   string  ` + "`json:\"-\"`" + `
+	Dash     string  ` + "`json:\"-,\"`" + `
+	internal string
+	Nested   struct {
+		Value string
+	} ` + "`json:\"nested\"`" + `
+}
+`
+	f := parseSource(t, src, WithEncodingJSON())
+	out := f.CUE()
+	assertContains(t, out,
+		"#Base: {\nID: string\n}",
+		"#Config: {\n#Base\nName: string\n",
+		`count: =~"^-?[0-9]+$"`,
+		"Ratio?: =~",
+		`enabled: "true" | "false"`,
+		"-: string",
+		"nested: {\nValue: string\n}",
+	)
+	for _, field := range []string{"Secret", "internal"} {
+		if strings.Contains(out, field) {
+			t.Errorf("field %s rendered:\n%s", field, out)
+		}
+	}
+
+	src = `package p
+
+type G[T int | int64] struct {
+	N T ` + "`json:\"n,string\"`" + `
+}
+
+type Alias = G[int]
+
+type Use struct {
+	G G[int64]
+	A Alias
+}
+`
+	for _, opts := range [][]Option{{WithEncodingJSON()}, {WithEncodingJSON(), WithCUEInlineAliases()}} {
+		out = parseSource(t, src, opts...).CUE()
+		assertContains(t, out, "#G_int64: {\nn: =~\"^-?[0-9]+$\"\n}")
+		if strings.Contains(out, "n: int") {
+			t.Errorf("string option lost:\n%s", out)
+		}
+	}
+}
+
+func TestNameTag(t *testing.T) {
+	src := `package p
+
+type Server struct {
+	Host string ` + "`yaml:\"host\" mapstructure:\"host\"`" + `
+}
+
+type Config struct {
+	Server  Server ` + "`yaml:\",inline\" mapstructure:\",squash\"`" + `
+	Timeout string ` + "`yaml:\"timeout,omitempty\" json:\"timeoutSeconds\"`" + `
+	Debug   bool   ` + "`json:\"debug\"`" + `
+	Secret  string ` + "`yaml:\"-\" json:\"secret\"`" + `
+}
+`
+	out := parseSource(t, src, WithNameTag("yaml", "json")).CUE()
+	assertContains(t, out, "#Server: {\nhost: string\n}", "#Config: {\n#Server\ntimeout?: string\ndebug: bool\n")
+	if strings.Contains(out, "secret") || strings.Contains(out, "-:") || strings.Contains(out, "timeoutSeconds") {
+		t.Errorf("field named after a tag later in the chain:\n%s", out)
+	}
+
+	out = parseSource(t, src, WithNameTag("mapstructure")).CUE()
+	assertContains(t, out, "#Config: {\n#Server\n}")
+
+	out = parseSource(t, `package p
+
+type Labels map[string]string
+
+type Plugin struct {
+	Name    string            `+"`yaml:\"name\"`"+`
+	MaxConn int               `+"`yaml:\",omitempty\"`"+`
+	Extra   map[string]string `+"`yaml:\",inline\"`"+`
+	Empty   struct{}          `+"`yaml:\",inline\"`"+`
+	Inner   struct {
+		Debug bool `+"`yaml:\"debug\"`"+`
+	} `+"`yaml:\",inline\"`"+`
+}
+
+type Annotated struct {
+	Labels `+"`yaml:\",inline\"`"+`
+}
+`, WithNameTag("yaml")).CUE()
+	assertContains(t, out,
+		"#Plugin: {\nname: string\nmaxconn?: int\n[!~\"^(name|maxconn|debug)$\"]: string\ndebug: bool\n}",
+		"#Annotated: {\n[string]: string\n}",
+	)
+}
+
+func TestConstraints(t *testing.T) {
+	f := parseSource(t, `package p
+
+type Port int
+
+type User struct {
+	Name  string            `+"`json:\"name,omitempty\" validate:\"required,min=1,max=64\"`"+`
+	Email string            `+"`json:\"email\" validate:\"email\"`"+`
+	Role  string            `+"`json:\"role\" validate:\"oneof=admin user 'power user'\"`"+`
+	Port  Port              `+"`json:\"port\" validate:\"gte=1,lt=65536\"`"+`
+	Tags  []string          `+"`json:\"tags\" validate:\"max=10,dive,min=1\"`"+`
+	Meta  map[string]string `+"`json:\"meta,omitempty\" validate:\"omitempty,min=1\"`"+`
+	Other string            `+"`json:\"other\" validate:\"eqfield=Name\"`"+`
+	Nick  string            `+"`json:\"nick\" validate:\"omitempty,min=3\"`"+`
+	Age   *int              `+"`json:\"age\" validate:\"omitempty,gte=18\"`"+`
+	Plan  string            `+"`json:\"plan\" validate:\"omitempty,oneof=free pro\"`"+`
+}
+`)
+	var messages []string
+	for _, d := range f.Diagnostics {
+		if d.Code == CodeUnsupportedRule {
+			messages = append(messages, d.Message)
+		}
+	}
+	want := []string{
+		"User.Tags: validate rule dive is not supported",
+		"User.Tags: validate rule min=1 is not supported",
+		"User.Other: validate rule eqfield=Name is not supported",
+	}
+	if !reflect.DeepEqual(messages, want) {
+		t.Errorf("got diagnostics %q, want %q", messages, want)
+	}
+	assertContains(t, f.CUE(),
+		"import (\n  \"list\"\n  \"strings\"\n  \"struct\"\n)",
+		"name: string & strings.MinRunes(1) & strings.MaxRunes(64)\n",
+		`email: string & =~"^[^@\\s]+@[^@\\s]+\\.[^@\\s]+$"`,
+		"role: \"admin\" | \"user\" | \"power user\"\n",
+		"port: #Port & >=1 & <65536",
+		"tags: [...string] & list.MaxItems(10)",
+		"meta?: null | ({[string]: string} & struct.MinFields(1))",
+		"nick: \"\" | (string & strings.MinRunes(3))\n",
+		"age: null | (int & >=18)\n",
+		"plan: \"\" | \"free\" | \"pro\"\n",
+	)
+	assertContains(t, string(f.Reflect()), `"constraints":{"required":true,"min_length":1,"max_length":64}`)
+}
+
+func TestMarkers(t *testing.T) {
+	f := parseSource(t, `package p
+
+// Replicas is a number of replicas.
+// +kubebuilder:validation:Minimum=1
+type Replicas int32
+
+// +kubebuilder:validation:Enum=Always;Never
+type Policy string
+
+// +enum
+// +kubebuilder:validation:Enum=Fast;Slow
+type Speed string
+
+// Spec is the desired state.
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="Size",type=integer,JSONPath=".spec.size"
+// +kubebuilder:printcolumn:name="Name",type=string,JSONPath=".spec.name"
+type Spec struct {
+	// Size is the number of replicas.
+	// +optional
+	// +kubebuilder:default=3
+	// +kubebuilder:validation:Maximum=10
+	Size int32 `+"`json:\"size\"`"+`
+
+	// +kubebuilder:validation:Pattern=`+"`^[a-z]+$`"+`
+	Name string `+"`json:\"name,omitempty\"`"+`
+
+	// +kubebuilder:validation:XValidation=self.size > 0
+	Policy Policy `+"`json:\"policy\"`"+`
+}
+`)
+	var messages []string
+	for _, d := range f.Diagnostics {
+		if d.Code == CodeUnsupportedRule {
+			messages = append(messages, d.Message)
+		}
+	}
+	want := []string{"Spec.Policy: marker +kubebuilder:validation:XValidation=self.size > 0 is not supported"}
+	if !reflect.DeepEqual(messages, want) {
+		t.Errorf("got diagnostics %q, want %q", messages, want)
+	}
+	cue := f.CUE()
+	assertContains(t, cue,
+		"// Replicas is a number of replicas.\n#Replicas: int32 & >=1\n",
+		"#Policy: \"Always\" | \"Never\"\n",
+		"// Spec is the desired state.\n#Spec: {",
+		"// Size is the number of replicas.\nsize?: *3 | int32 & <=10\n",
+		"name?: string & =~\"^[a-z]+$\"\n",
+	)
+	if strings.Contains(cue, "+kubebuilder") || strings.Contains(cue, "+optional") {
+		t.Errorf("markers leak into the CUE output:\n%s", cue)
+	}
+	assertContains(t, f.Go(),
+		"// Spec is the desired state.\n// +kubebuilder:object:root=true\n"+
+			"// +kubebuilder:printcolumn:name=\"Size\",type=integer,JSONPath=\".spec.size\"\n"+
+			"// +kubebuilder:printcolumn:name=\"Name\",type=string,JSONPath=\".spec.name\"\ntype Spec struct",
+		"// +optional\n\t// +kubebuilder:default=3\n\t// +kubebuilder:validation:Maximum=10\n\tSize int32",
+		"// +enum\n// +kubebuilder:validation:Enum=Fast;Slow\ntype Speed string\n\nconst (\n\tSpeedFast Speed = \"Fast\"\n",
+	)
+	if _, ok := f.Code[2].(*EnumType); !ok {
+		t.Errorf("got %T for a type with an enum marker, want *EnumType", f.Code[2])
+	}
+	assertContains(t, string(f.Reflect()),
+		`"markers":[{"name":"kubebuilder:object:root","value":"true"},{"name":"kubebuilder:printcolumn`,
+		`"constraints":{"optional":true,"maximum":10,"default":3}`,
+	)
+}
+
+func TestDirectives(t *testing.T) {
+	f := parseSource(t, `package p
+
+import "time"
+
+//toast:skip
+type Internal struct{}
+
+// Policy is a restart policy.
+//toast:enum=Always;OnFailure
+type Policy string
+
+//toast:name=Config
+type config struct {
+	// Timeout is how long to wait.
+	//toast:type=string
+	Timeout time.Duration `+"`json:\"timeout\"`"+`
+	//toast:optional
+	Policy Policy `+"`json:\"policy\"`"+`
+	//toast:name=user_id
+	UserID string `+"`json:\"userId,omitempty\"`"+`
+	//toast:skip
+	Cache map[string]string `+"`json:\"cache\"`"+`
+	//toast:bogus
+	Other string `+"`json:\"other\"`"+`
+}
+
+type Service struct {
+	Config config `+"`json:\"config\"`"+`
+}
+`, WithTransform(&ExcludeType{
+		Match: func(t Type) bool {
+			return t.GetName() == "config"
+		},
+	}))
+	var messages []string
+	for _, d := range f.Diagnostics {
+		if d.Code == CodeBadDirective {
+			messages = append(messages, d.Message)
+		}
+	}
+	want := []string{"Config.Other: directive toast:bogus cannot be applied"}
+	if !reflect.DeepEqual(messages, want) {
+		t.Errorf("got diagnostics %q, want %q", messages, want)
+	}
+	cue := f.CUE()
+	assertContains(t, cue,
+		"// Policy is a restart policy.\n#Policy: \"Always\" | \"OnFailure\"\n\nPolicyAlways: \"Always\"\n",
+		"#Config: {\n// Timeout is how long to wait.\ntimeout: string\npolicy?: #Policy\nuser_id?: string\nother: string\n}",
+		"config: #Config\n",
+	)
+	for _, unwanted := range []string{"Internal", "cache", "toast:"} {
+		if strings.Contains(cue, unwanted) {
+			t.Errorf("output contains %q:\n%s", unwanted, cue)
+		}
+	}
+	assertContains(t, string(f.Reflect()),
+		`"directives":{"name":"Config"}`,
+		`"directives":{"type":"string"}`,
+		`"directives":{"enum":"Always;OnFailure"}`,
+	)
+}
+
+type reflectConfig struct {
+	reflectBase
+	Name    string            `json:"name"`
+	Timeout time.Duration     `json:"timeout"`
+	Retry   *reflectRetry     `json:"retry,omitempty"`
+	Labels  map[string]string `json:"labels"`
+	Hosts   []string          `json:"hosts"`
+	Options struct {
+		Debug bool `json:"debug"`
+	} `json:"options"`
+	Internal string `json:"-"`
+	hidden   int
+}
+
+type reflectBase struct {
+	ID string `json:"id"`
+}
+
+type reflectRetry struct {
+	Max reflectCount `json:"max"`
+}
+
+type reflectCount int
+
+type reflectList struct {
+	Page  reflectPage[reflectCount] `json:"page"`
+	Names reflectPage[string]       `json:"names"`
+	Ints  reflectPage[int]          `json:"ints"`
+	Text  *template.Template        `json:"text"`
+	HTML  *htmltemplate.Template    `json:"html"`
+}
+
+type reflectPage[T any] struct {
+	Items  []T         `json:"items"`
+	Next   *T          `json:"next"`
+	Total  int         `json:"total"`
+	Counts map[int]int `json:"counts"`
+}
+
+func TestFileFromValues(t *testing.T) {
+	f, err := FileFromValues([]interface{}{&reflectConfig{}}, WithTransform(&ExcludeField{
+		Match: func(field *Field) bool {
+			return field.GetName() == "Internal"
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.pkgName != "toast" {
+		t.Errorf("got package %s, want toast", f.pkgName)
+	}
+	var names []string
+	for _, t := range f.Code {
+		names = append(names, t.GetName())
+	}
+	if want := []string{"reflectConfig", "reflectBase", "reflectRetry", "reflectCount"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got declarations %v, want %v", names, want)
+	}
+	if imp, ok := f.Imports["time"]; !ok || imp.Path != "time" {
+		t.Errorf("got imports %v, want time", f.Imports)
+	}
+	out := f.Go()
+	assertContains(t, out, "\treflectBase\n", "Timeout time.Duration     `json:\"timeout\"`", "Retry   *reflectRetry", "Debug bool `json:\"debug\"`", "type reflectCount int")
+	if strings.Contains(out, "Internal") || strings.Contains(out, "hidden") {
+		t.Errorf("excluded or unexported field rendered:\n%s", out)
+	}
+	assertContains(t, f.CUE(), "#reflectConfig: {\n#reflectBase\n", "timeout: int64", "retry?: #reflectRetry", "max: #reflectCount")
+
+	f, err = FromReflect(reflect.TypeOf(reflectList{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Diagnostics) > 0 {
+		t.Errorf("unexpected diagnostics: %v", f.Diagnostics)
+	}
+	assertContains(t, f.Go(),
+		"\ttemplate2 \"html/template\"\n\t\"text/template\"\n",
+		"Page  reflectPage_reflectCount", "Ints  reflectPage_int", "Text  *template.Template", "HTML  *template2.Template",
+		"type reflectPage_int struct {\n\tItems  []int       `json:\"items\"`\n\tNext   *int        `json:\"next\"`\n"+
+			"\tTotal  int         `json:\"total\"`\n\tCounts map[int]int `json:\"counts\"`",
+		"type reflectCount int",
+	)
+	assertContains(t, f.CUE(), "page: #reflectPage_reflectCount", "names: #reflectPage_string",
+		"#reflectPage_reflectCount: {\nitems: [...#reflectCount]\nnext: #reflectCount\ntotal: int\n",
+		"#reflectPage_int: {\nitems: [...int]\nnext: int\ntotal: int\ncounts: [int]: int\n}")
+
+	if _, err := FromReflect(reflect.TypeOf(map[string]int{})); err == nil {
+		t.Error("expected an error for an unnamed type")
+	}
+}
@@ -0,0 +1,126 @@
+package toast
+
+import (
+	"go/ast"
+	"strings"
+	"unicode"
+
+	"github.com/fatih/structtag"
+)
+
+// recordOneof records the wrapper type of a oneof from the method that
+// protoc-gen-go generates to mark it, such as
+//
+//	func (*Msg_Name) isMsg_Kind() {}
+//
+// for the wrapper Msg_Name of the oneof interface isMsg_Kind.
+func (f *File) recordOneof(fd *ast.FuncDecl) {
+	if fd.Recv == nil || len(fd.Recv.List) != 1 || !strings.HasPrefix(fd.Name.Name, "is") || fd.Name.IsExported() {
+		return
+	}
+	if fd.Type.Params.NumFields() > 0 || fd.Type.Results.NumFields() > 0 {
+		return
+	}
+	star, ok := fd.Recv.List[0].Type.(*ast.StarExpr)
+	if !ok {
+		return
+	}
+	recv, ok := star.X.(*ast.Ident)
+	if !ok {
+		return
+	}
+	if f.oneofs == nil {
+		f.oneofs = make(map[string][]string)
+	}
+	f.oneofs[fd.Name.Name] = append(f.oneofs[fd.Name.Name], recv.Name)
+}
+
+// protobufFields leaves out the internal fields of the structs in code, and
+// resolves oneof fields to their wrapper types. Fields are named after their
+// protobuf tags in the output only (see protoJSONFields).
+func (f *File) protobufFields(code []Type) {
+	for _, t := range code {
+		st, ok := t.(*StructType)
+		if !ok {
+			continue
+		}
+		var fields []*Field
+		for _, field := range st.Fields {
+			if isProtoInternal(field) {
+				continue
+			}
+			if field.tag("protobuf_oneof") != nil {
+				if pt, ok := field.Type.(*PlainType); ok && pt.Type.Kind == RefNamed {
+					for _, wrapper := range f.oneofs[pt.Type.Name] {
+						field.OneOf = append(field.OneOf, &TypeRef{Kind: RefNamed, Name: wrapper})
+					}
+				}
+			}
+			if nested, ok := field.Type.(*StructType); ok {
+				f.protobufFields([]Type{nested})
+			}
+			fields = append(fields, field)
+		}
+		st.Fields = fields
+	}
+}
+
+// isProtoInternal reports whether field is one that protoc-gen-go adds for
+// its own use, such as state, sizeCache and unknownFields, or the XXX_ fields
+// of older versions.
+func isProtoInternal(field *Field) bool {
+	name := field.GetName()
+	if strings.HasPrefix(name, "XXX_") {
+		return true
+	}
+	return name != "" && unicode.IsLower(rune(name[0])) && field.tag("protobuf") == nil && field.tag("protobuf_oneof") == nil
+}
+
+// protoJSONFields sets the JSON name of each field of st to the one protojson
+// uses: the json= option of its protobuf tag, or else its name= option. Other
+// options of the json tag are kept, except in a oneof wrapper, whose field is
+// required. st must be a copy, as returned by withPolicies.
+func protoJSONFields(st *StructType) {
+	for i, field := range st.Fields {
+		if nested, ok := field.Type.(*StructType); ok {
+			protoJSONFields(nested)
+		}
+		tag := field.tag("protobuf")
+		if tag == nil {
+			continue
+		}
+		jsonTag := protoJSONTag(tag)
+		if jsonTag == nil {
+			continue
+		}
+		if existing := field.tag("json"); existing != nil && !tag.HasOption("oneof") {
+			jsonTag.Options = existing.Options
+		}
+		c := *field
+		c.Tags = cloneTags(field.Tags)
+		c.Tags.Set(jsonTag)
+		st.Fields[i] = &c
+	}
+}
+
+// protoJSONTag returns the json tag equivalent to a protobuf tag, naming the
+// field as protojson does. Fields are optional, except in a oneof wrapper.
+func protoJSONTag(tag *structtag.Tag) *structtag.Tag {
+	var name string
+	for _, opt := range tag.Options {
+		if strings.HasPrefix(opt, "json=") {
+			name = strings.TrimPrefix(opt, "json=")
+			break
+		}
+		if strings.HasPrefix(opt, "name=") {
+			name = strings.TrimPrefix(opt, "name=")
+		}
+	}
+	if name == "" {
+		return nil
+	}
+	if tag.HasOption("oneof") {
+		return &structtag.Tag{Key: "json", Name: name}
+	}
+	return &structtag.Tag{Key: "json", Name: name, Options: []string{"omitempty"}}
+}
@@ -0,0 +1,266 @@
+package toast
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/fatih/structtag"
+)
+
+// FromReflect is like NewFile for a type only available at runtime, such as
+// a registered plugin config. The file declares t and the named types of its
+// package that it refers to, in turn. Types of other packages are referred to
+// by import. Since there is no source, nodes have no docs or positions, and
+// unexported struct fields are left out.
+func FromReflect(t reflect.Type, opts ...Option) (*File, error) {
+	return fileFromTypes([]reflect.Type{t}, opts...)
+}
+
+// FileFromValues is like FromReflect for the types of values, which may be
+// pointers, such as FileFromValues([]interface{}{&Config{}}). The types must
+// be named and of the same package.
+func FileFromValues(values []interface{}, opts ...Option) (*File, error) {
+	typs := make([]reflect.Type, len(values))
+	for i, v := range values {
+		t := reflect.TypeOf(v)
+		for t != nil && t.Kind() == reflect.Ptr && t.Name() == "" {
+			t = t.Elem()
+		}
+		typs[i] = t
+	}
+	return fileFromTypes(typs, opts...)
+}
+
+func fileFromTypes(typs []reflect.Type, opts ...Option) (*File, error) {
+	if len(typs) == 0 {
+		return nil, fmt.Errorf("no types")
+	}
+	for _, t := range typs {
+		if t == nil || t.Name() == "" || t.PkgPath() == "" {
+			return nil, fmt.Errorf("%v is not a named type", t)
+		}
+		if t.PkgPath() != typs[0].PkgPath() {
+			return nil, fmt.Errorf("types of packages %s and %s", typs[0].PkgPath(), t.PkgPath())
+		}
+	}
+
+	f := &File{
+		pkgName:    reflectPackage(typs[0]),
+		Imports:    make(map[string]Import),
+		chanPolicy: PolicySkip,
+	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	r := &reflector{f: f, pkgPath: typs[0].PkgPath(), seen: make(map[reflect.Type]bool)}
+	for _, t := range typs {
+		r.queue(t)
+	}
+	for len(r.todo) > 0 {
+		t := r.todo[0]
+		r.todo = r.todo[1:]
+		decl, err := r.node(r.declName(t), t)
+		if err != nil {
+			f.diagnose(SeverityError, err)
+			continue
+		}
+		f.declare(decl)
+	}
+
+	return f.finish()
+}
+
+// reflector builds the nodes of the named types of a package from
+// reflection.
+type reflector struct {
+	f       *File
+	pkgPath string
+	// seen are the types declared or to be declared.
+	seen map[reflect.Type]bool
+	todo []reflect.Type
+}
+
+func (r *reflector) queue(t reflect.Type) {
+	if !r.seen[t] {
+		r.seen[t] = true
+		r.todo = append(r.todo, t)
+	}
+}
+
+// declName returns the name of the declaration of the named type t of the
+// package. Reflection only knows the instantiations of generic types, not
+// their declarations, so each instantiation is declared as a type of its own,
+// named as CUE output expands it, e.g. Page_User for Page[User].
+func (r *reflector) declName(t reflect.Type) string {
+	name, _, generic := strings.Cut(t.Name(), "[")
+	if !generic {
+		return name
+	}
+	return instanceName(name, r.typeArgs(t))
+}
+
+// node returns a node named name for the structure of t, regardless of
+// whether t itself is named, as ParseExpr does for a type expression.
+func (r *reflector) node(name string, t reflect.Type) (Type, error) {
+	switch t.Kind() {
+	case reflect.Slice:
+		return &ArrayType{Name: name, Type: r.ref(t.Elem())}, nil
+	case reflect.Array:
+		return &ArrayType{Name: name, Type: r.ref(t.Elem()), Length: t.Len()}, nil
+	case reflect.Map:
+		return &MapType{Name: name, KeyType: r.ref(t.Key()), ValueType: r.ref(t.Elem())}, nil
+	case reflect.Chan:
+		return &ChanType{Name: name, Type: r.ref(t.Elem()), Dir: chanDirFromReflect(t.ChanDir())}, nil
+	case reflect.Func:
+		ref := r.funcRef(t)
+		return &FuncType{Name: name, Params: ref.Params, Results: ref.Results}, nil
+	case reflect.Interface:
+		it := &InterfaceType{Name: name}
+		for i := 0; i < t.NumMethod(); i++ {
+			m := t.Method(i)
+			ref := r.funcRef(m.Type)
+			it.Methods = append(it.Methods, &Method{Name: m.Name, Params: ref.Params, Results: ref.Results})
+		}
+		return it, nil
+	case reflect.Struct:
+		return r.structType(name, t)
+	case reflect.Ptr:
+		return &PlainType{Name: name, Type: r.ref(t)}, nil
+	}
+	return &PlainType{Name: name, Type: &TypeRef{Kind: RefNamed, Name: t.Kind().String()}}, nil
+}
+
+func (r *reflector) structType(name string, t reflect.Type) (*StructType, error) {
+	st := &StructType{Name: name}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() && !sf.Anonymous {
+			continue
+		}
+		var typ Type
+		if sf.Type.Name() != "" {
+			typ = &PlainType{Name: sf.Name, Type: r.ref(sf.Type)}
+		} else {
+			var err error
+			if typ, err = r.node(sf.Name, sf.Type); err != nil {
+				return nil, err
+			}
+		}
+		tags, err := structtag.Parse(string(sf.Tag))
+		if err != nil {
+			return nil, &parseError{code: CodeBadTag, err: fmt.Errorf("%s.%s: %w: `%s`", name, sf.Name, err, sf.Tag)}
+		}
+		st.Fields = append(st.Fields, &Field{Type: typ, Tags: tags, Embedded: sf.Anonymous})
+	}
+	return st, nil
+}
+
+// ref returns a reference to t, queueing the named types of the package for
+// declaration, and importing those of other packages.
+func (r *reflector) ref(t reflect.Type) *TypeRef {
+	if t.Name() != "" {
+		name, _, _ := strings.Cut(t.Name(), "[")
+		ref := &TypeRef{Kind: RefNamed, Name: name, Args: r.typeArgs(t)}
+		switch t.PkgPath() {
+		case "":
+			return ref
+		case r.pkgPath:
+			r.queue(t)
+			return &TypeRef{Kind: RefNamed, Name: r.declName(t)}
+		}
+		ref.Package, ref.Path = r.importName(t.PkgPath(), reflectPackage(t)), t.PkgPath()
+		if t.Kind() <= reflect.Complex128 || t.Kind() == reflect.String {
+			ref.Underlying = &TypeRef{Kind: RefNamed, Name: t.Kind().String()}
+		}
+		return ref
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return r.ref(t.Elem()).pointerTo()
+	case reflect.Slice:
+		return &TypeRef{Kind: RefSlice, Elem: r.ref(t.Elem())}
+	case reflect.Array:
+		return &TypeRef{Kind: RefArray, Elem: r.ref(t.Elem()), Length: t.Len()}
+	case reflect.Map:
+		return &TypeRef{Kind: RefMap, Key: r.ref(t.Key()), Value: r.ref(t.Elem())}
+	case reflect.Chan:
+		return &TypeRef{Kind: RefChan, Elem: r.ref(t.Elem()), Dir: chanDirFromReflect(t.ChanDir())}
+	case reflect.Func:
+		return r.funcRef(t)
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			return &TypeRef{Kind: RefInterface, Expr: "interface{}"}
+		}
+		return &TypeRef{Kind: RefInterface, Expr: t.String()}
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			r.ref(t.Field(i).Type)
+		}
+		return &TypeRef{Kind: RefStruct, Expr: t.String()}
+	}
+	return &TypeRef{Kind: RefInvalid, Expr: t.String()}
+}
+
+// qualifiedName matches a name qualified with the path of its package in the
+// type arguments of a reflected generic type, such as net/http.Header.
+var qualifiedName = regexp.MustCompile(`([\w.~/-]+)\.(\w+)`)
+
+// typeArgs returns the type arguments of the instantiated generic type t,
+// which reflection only gives as part of its name, with the packages of the
+// types in them qualified by path. Those packages are imported, named after
+// the last element of their path.
+func (r *reflector) typeArgs(t reflect.Type) []*TypeRef {
+	_, args, ok := strings.Cut(t.Name(), "[")
+	if !ok {
+		return nil
+	}
+	args = qualifiedName.ReplaceAllStringFunc(args, func(s string) string {
+		m := qualifiedName.FindStringSubmatch(s)
+		if m[1] == r.pkgPath {
+			return m[2]
+		}
+		return r.importName(m[1], m[1][strings.LastIndex(m[1], "/")+1:]) + "." + m[2]
+	})
+	return ParseTypeRef("_[" + args).Args
+}
+
+// importName returns the name the package of path is imported with, adding
+// an import of it as pkg if there is none (see File.importName).
+func (r *reflector) importName(path, pkg string) string {
+	return r.f.importName(Import{Path: path, oldPath: path}, pkg)
+}
+
+func (r *reflector) funcRef(t reflect.Type) *TypeRef {
+	ref := &TypeRef{Kind: RefFunc}
+	for i := 0; i < t.NumIn(); i++ {
+		p := &Param{Type: r.ref(t.In(i))}
+		if t.IsVariadic() && i == t.NumIn()-1 {
+			p.Type, p.Variadic = p.Type.Elem, true
+		}
+		ref.Params = append(ref.Params, p)
+	}
+	for i := 0; i < t.NumOut(); i++ {
+		ref.Results = append(ref.Results, &Param{Type: r.ref(t.Out(i))})
+	}
+	return ref
+}
+
+func chanDirFromReflect(dir reflect.ChanDir) ChanDir {
+	switch dir {
+	case reflect.SendDir:
+		return ChanSend
+	case reflect.RecvDir:
+		return ChanRecv
+	}
+	return ChanBoth
+}
+
+// reflectPackage returns the name of the package of a named type, which
+// reflection only gives as the qualifier of its name.
+func reflectPackage(t reflect.Type) string {
+	return strings.TrimSuffix(t.String(), "."+t.Name())
+}
@@ -0,0 +1,365 @@
+package toast
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// TypeRef is a reference to a type, such as the type of a field, the element
+// type of a slice or the key type of a map. Composite types nest references
+// to the types they are made of, so "map[string][]*bytes.Buffer" is a map
+// whose value is a slice of pointers to the named type Buffer in package
+// bytes.
+type TypeRef struct {
+	Kind RefKind `json:"kind"`
+	// Pointer is set for a pointer to the referenced type. A pointer to a
+	// pointer is a RefPointer whose Elem is the inner pointer.
+	Pointer bool `json:"pointer,omitempty"`
+	// Package is the package qualifier of a named type, e.g. "bytes" for
+	// bytes.Buffer.
+	Package string `json:"package,omitempty"`
+	// Path is the import path of the package of a named type. It is only set
+	// for files loaded with type information, as is Underlying, and for
+	// well-known types.
+	Path string `json:"path,omitempty"`
+	// Name is the name of a named type, which includes the basic types.
+	Name string `json:"name,omitempty"`
+	// Args are the type arguments of an instantiated generic type.
+	Args []*TypeRef `json:"args,omitempty"`
+	// Elem is the element type of a slice, array or channel.
+	Elem *TypeRef `json:"elem,omitempty"`
+	// Key and Value are the key and value types of a map.
+	Key   *TypeRef `json:"key,omitempty"`
+	Value *TypeRef `json:"value,omitempty"`
+	// Length and LengthExpr are the length of an array, as in ArrayType.
+	Length     int    `json:"length,omitempty"`
+	LengthExpr string `json:"length_expr,omitempty"`
+	// Dir is the direction of a channel.
+	Dir ChanDir `json:"dir,omitempty"`
+	// Params and Results are the signature of a function.
+	Params  []*Param `json:"params,omitempty"`
+	Results []*Param `json:"results,omitempty"`
+	// Terms are the terms of a union in a type constraint. Tilde is set on
+	// terms that stand for every type with that underlying type.
+	Terms []*TypeRef `json:"terms,omitempty"`
+	Tilde bool       `json:"tilde,omitempty"`
+	// Expr is the source of inline struct and interface types, and of
+	// expressions that are not types.
+	Expr string `json:"expr,omitempty"`
+	// Underlying is the underlying type of a named type, e.g. int64 for
+	// time.Duration.
+	Underlying *TypeRef `json:"underlying,omitempty"`
+	// WellKnown is the JSON form of a protobuf well-known type, e.g.
+	// "duration" for durationpb.Duration. See WellKnownTypes.
+	WellKnown string `json:"well_known,omitempty"`
+}
+
+// RefKind is the kind of type a TypeRef refers to.
+type RefKind int
+
+const (
+	RefInvalid RefKind = iota
+	RefNamed
+	RefPointer
+	RefSlice
+	RefArray
+	RefMap
+	RefChan
+	RefFunc
+	RefInterface
+	RefStruct
+	RefUnion
+)
+
+var refKinds = [...]string{
+	RefInvalid:   "invalid",
+	RefNamed:     "named",
+	RefPointer:   "pointer",
+	RefSlice:     "slice",
+	RefArray:     "array",
+	RefMap:       "map",
+	RefChan:      "chan",
+	RefFunc:      "func",
+	RefInterface: "interface",
+	RefStruct:    "struct",
+	RefUnion:     "union",
+}
+
+func (k RefKind) String() string {
+	return refKinds[k]
+}
+
+func (k RefKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// ParseTypeRef parses a Go type expression such as "map[string][]int". A
+// string that is not a valid type expression is kept as the name of an
+// unqualified named type, so that it is rendered as is.
+func ParseTypeRef(typ string) *TypeRef {
+	expr, err := parser.ParseExpr(typ)
+	if err != nil {
+		return &TypeRef{Kind: RefNamed, Name: typ}
+	}
+	return TypeRefFromExpr(expr)
+}
+
+// TypeRefFromExpr returns a reference to the type expressed by e, which is a
+// RefInvalid holding the source of e if it is not a type expression.
+func TypeRefFromExpr(e ast.Expr) *TypeRef {
+	switch t := e.(type) {
+	case *ast.Ident:
+		return &TypeRef{Kind: RefNamed, Name: t.Name}
+	case *ast.SelectorExpr:
+		if x, ok := t.X.(*ast.Ident); ok {
+			return &TypeRef{Kind: RefNamed, Package: x.Name, Name: t.Sel.Name}
+		}
+	case *ast.ParenExpr:
+		return TypeRefFromExpr(t.X)
+	case *ast.StarExpr:
+		return TypeRefFromExpr(t.X).pointerTo()
+	case *ast.ArrayType:
+		elem := TypeRefFromExpr(t.Elt)
+		if t.Len == nil {
+			return &TypeRef{Kind: RefSlice, Elem: elem}
+		}
+		length, lengthExpr := arrayLength(t.Len)
+		return &TypeRef{Kind: RefArray, Elem: elem, Length: length, LengthExpr: lengthExpr}
+	case *ast.MapType:
+		return &TypeRef{Kind: RefMap, Key: TypeRefFromExpr(t.Key), Value: TypeRefFromExpr(t.Value)}
+	case *ast.ChanType:
+		return &TypeRef{Kind: RefChan, Elem: TypeRefFromExpr(t.Value), Dir: chanDirFromAST(t.Dir)}
+	case *ast.FuncType:
+		return &TypeRef{Kind: RefFunc, Params: ParamsFromFieldList(t.Params), Results: ParamsFromFieldList(t.Results)}
+	case *ast.InterfaceType:
+		return &TypeRef{Kind: RefInterface, Expr: exprSource(t)}
+	case *ast.StructType:
+		return &TypeRef{Kind: RefStruct, Expr: exprSource(t)}
+	case *ast.IndexExpr:
+		ref := TypeRefFromExpr(t.X)
+		ref.Args = []*TypeRef{TypeRefFromExpr(t.Index)}
+		return ref
+	case *ast.IndexListExpr:
+		ref := TypeRefFromExpr(t.X)
+		for _, idx := range t.Indices {
+			ref.Args = append(ref.Args, TypeRefFromExpr(idx))
+		}
+		return ref
+	case *ast.BinaryExpr:
+		x, y := TypeRefFromExpr(t.X), TypeRefFromExpr(t.Y)
+		terms := []*TypeRef{x}
+		if x.Kind == RefUnion {
+			terms = x.Terms
+		}
+		return &TypeRef{Kind: RefUnion, Terms: append(terms, y)}
+	case *ast.UnaryExpr:
+		ref := TypeRefFromExpr(t.X)
+		ref.Tilde = true
+		return ref
+	}
+	return &TypeRef{Kind: RefInvalid, Expr: types.ExprString(e)}
+}
+
+// exprSource renders e as Go source.
+func exprSource(e ast.Expr) string {
+	var b bytes.Buffer
+	printer.Fprint(&b, token.NewFileSet(), e)
+	return b.String()
+}
+
+// pointerTo returns a reference to a pointer to r.
+func (r *TypeRef) pointerTo() *TypeRef {
+	if r.Pointer {
+		return &TypeRef{Kind: RefPointer, Pointer: true, Elem: r}
+	}
+	p := *r
+	p.Pointer = true
+	return &p
+}
+
+// String renders r as a Go type expression.
+func (r *TypeRef) String() string {
+	if r == nil {
+		return ""
+	}
+	var s string
+	switch r.Kind {
+	case RefNamed:
+		s = r.Name
+		if r.Package != "" {
+			s = r.Package + "." + s
+		}
+		if len(r.Args) > 0 {
+			s += "[" + joinRefs(r.Args, ", ") + "]"
+		}
+	case RefPointer:
+		s = r.Elem.String()
+	case RefSlice:
+		s = "[]" + r.Elem.String()
+	case RefArray:
+		s = fmt.Sprintf("[%s]%s", r.lengthString(), r.Elem)
+	case RefMap:
+		s = fmt.Sprintf("map[%s]%s", r.Key, r.Value)
+	case RefChan:
+		s = fmtChan(r.Dir, r.Elem.String())
+	case RefFunc:
+		s = "func" + fmtSignature(r.Params, r.Results)
+	case RefUnion:
+		s = joinRefs(r.Terms, " | ")
+	default:
+		s = r.Expr
+	}
+	if r.Pointer {
+		s = "*" + s
+	}
+	if r.Tilde {
+		s = "~" + s
+	}
+	return s
+}
+
+func (r *TypeRef) lengthString() string {
+	if r.Length > 0 {
+		return fmt.Sprint(r.Length)
+	}
+	return r.LengthExpr
+}
+
+func joinRefs(refs []*TypeRef, sep string) string {
+	strs := make([]string, len(refs))
+	for i, ref := range refs {
+		strs[i] = ref.String()
+	}
+	return strings.Join(strs, sep)
+}
+
+// Walk calls fn for r and for each type r is made of, depth-first, until fn
+// returns false.
+func (r *TypeRef) Walk(fn func(*TypeRef) bool) bool {
+	if r == nil {
+		return true
+	}
+	if !fn(r) {
+		return false
+	}
+	for _, ref := range r.refs() {
+		if !ref.Walk(fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// refs returns the references r is directly made of.
+func (r *TypeRef) refs() []*TypeRef {
+	refs := append([]*TypeRef(nil), r.Args...)
+	refs = append(refs, r.Terms...)
+	for _, ref := range []*TypeRef{r.Elem, r.Key, r.Value} {
+		if ref != nil {
+			refs = append(refs, ref)
+		}
+	}
+	for _, p := range joinParams(r.Params, r.Results) {
+		refs = append(refs, p.Type)
+	}
+	return refs
+}
+
+// IsBasic reports whether r refers to a predeclared basic type such as int or
+// string, not counting pointers.
+func (r *TypeRef) IsBasic() bool {
+	return r.Kind == RefNamed && r.Package == "" && len(r.Args) == 0 && basicTypes[r.Name]
+}
+
+// Clone returns a deep copy of r.
+func (r *TypeRef) Clone() *TypeRef {
+	return r.Subst(nil)
+}
+
+// Subst returns a copy of r in which each unqualified named type without type
+// arguments that is a key in subst is replaced with the corresponding type.
+func (r *TypeRef) Subst(subst map[string]*TypeRef) *TypeRef {
+	if r == nil {
+		return nil
+	}
+	if r.Kind == RefNamed && r.Package == "" && len(r.Args) == 0 {
+		if s, ok := subst[r.Name]; ok {
+			c := s.Clone()
+			if r.Pointer {
+				c = c.pointerTo()
+			}
+			c.Tilde = c.Tilde || r.Tilde
+			return c
+		}
+	}
+	c := *r
+	c.Args = substRefs(r.Args, subst)
+	c.Terms = substRefs(r.Terms, subst)
+	c.Elem = r.Elem.Subst(subst)
+	c.Key = r.Key.Subst(subst)
+	c.Value = r.Value.Subst(subst)
+	c.Params = substParams(r.Params, subst)
+	c.Results = substParams(r.Results, subst)
+	return &c
+}
+
+func substRefs(refs []*TypeRef, subst map[string]*TypeRef) []*TypeRef {
+	if refs == nil {
+		return nil
+	}
+	c := make([]*TypeRef, len(refs))
+	for i, ref := range refs {
+		c[i] = ref.Subst(subst)
+	}
+	return c
+}
+
+func substParams(params []*Param, subst map[string]*TypeRef) []*Param {
+	c := cloneParams(params)
+	for _, p := range c {
+		p.Type = p.Type.Subst(subst)
+	}
+	return c
+}
+
+// typeNames returns the Go type expressions of the references in t.
+func typeNames(t Type) []string {
+	refs := t.GetTypeRefs()
+	typs := make([]string, len(refs))
+	for i, ref := range refs {
+		typs[i] = ref.String()
+	}
+	return typs
+}
+
+// setTypeNames replaces the references in t with those parsed from typs.
+func setTypeNames(t Type, typs []string) {
+	refs := make([]*TypeRef, len(typs))
+	for i, typ := range typs {
+		refs[i] = ParseTypeRef(typ)
+	}
+	t.SetTypeRefs(refs)
+}
+
+// refPackages returns the package names used by refs, including those used by
+// array lengths and inline struct and interface types.
+func refPackages(refs []*TypeRef) []string {
+	var pkgs []string
+	for _, ref := range refs {
+		ref.Walk(func(r *TypeRef) bool {
+			if r.Package != "" {
+				pkgs = append(pkgs, r.Package)
+			}
+			pkgs = append(pkgs, qualifiers(r.LengthExpr)...)
+			pkgs = append(pkgs, qualifiers(r.Expr)...)
+			return true
+		})
+	}
+	return pkgs
+}
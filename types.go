@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-
+	"go/constant"
+	"go/token"
+	"go/types"
 	"strings"
 
 	"github.com/fatih/structtag"
@@ -15,7 +17,19 @@ type Type interface {
 	GetName() string
 	GetTypeNames() []string
 	SetTypeNames([]string)
+	GetTypeRefs() []*TypeRef
+	SetTypeRefs([]*TypeRef)
 	GetDocs() string
+	GetComment() string
+	GetMarkers() []*Marker
+	GetDirectives() map[string]string
+	GetPos() *Position
+	GetTypeParams() []*TypeParam
+	IsAlias() bool
+
+	meta() *Meta
+	setName(string)
+	setDocs(string)
 }
 
 type Node interface {
@@ -30,9 +44,16 @@ type Node interface {
 type File struct {
 	pkgName    string
 	cuePkgName string
+	fset       *token.FileSet
+	types      *types.Package
+	srcDir     string
+	bundle     bool
+	protobuf   bool
 
 	Imports map[string]Import
 	Code    []Type
+	// Diagnostics are the problems found while parsing the file.
+	Diagnostics Diagnostics
 
 	trans        []Transform
 	copies       []*CopyIntoStruct
@@ -40,6 +61,20 @@ type File struct {
 	modimports   []*ModifyImport
 	genEnumTrans []*GenEnumTypeTransform
 	mkEnums      []*PromoteToEnumType
+	enumConsts   []*enumConst
+	oneofs       map[string][]string
+	renames      map[string]string
+	consts       map[string]constant.Value
+	pkgCode      []Type
+
+	funcPolicy Policy
+	chanPolicy Policy
+	strict     bool
+	lenient    bool
+
+	cueInlineAliases bool
+	encodingJSON     bool
+	nameTags         []string
 
 	debug bool
 }
@@ -49,9 +84,12 @@ func (f *File) Reflect() json.RawMessage {
 	for _, imp := range f.Imports {
 		imports = append(imports, string(imp.Reflect()))
 	}
-	code := make([]string, len(f.Code))
-	for i, t := range f.Code {
-		code[i] = string(t.Reflect())
+	code := make([]string, 0, len(f.Code))
+	for _, t := range f.withPolicies(f.Code) {
+		if st, ok := t.(*StructType); ok && f.protobuf {
+			protoJSONFields(st)
+		}
+		code = append(code, string(t.Reflect()))
 	}
 	raw := fmt.Sprintf(
 		`{"package":"%s","imports":[%s],"code":[%s]}`,
@@ -64,11 +102,154 @@ func (f *File) Reflect() json.RawMessage {
 	return json.RawMessage(raw)
 }
 
+// policyFor returns the kind of type that t is subject to a policy for, such
+// as "func", along with the policy. kind is empty if no policy applies.
+func (f *File) policyFor(t Type) (kind string, p Policy) {
+	return f.policyForDecl(t, make(map[string]bool))
+}
+
+// policyForDecl is policyFor, following the declarations t refers to unless
+// they are visited already, as with mutually recursive types.
+func (f *File) policyForDecl(t Type, visited map[string]bool) (kind string, p Policy) {
+	switch t.(type) {
+	case *StructType, *InterfaceType:
+		return "", 0
+	case *FuncType:
+		return "func", f.funcPolicy
+	case *ChanType:
+		return "chan", f.chanPolicy
+	}
+	for _, ref := range t.GetTypeRefs() {
+		ref.Walk(func(r *TypeRef) bool {
+			switch r.Kind {
+			case RefFunc:
+				kind, p = "func", f.funcPolicy
+			case RefChan:
+				kind, p = "chan", f.chanPolicy
+			case RefNamed:
+				if decl := f.decl(r.Name); r.Package == "" && decl != nil && !visited[r.Name] {
+					visited[r.Name] = true
+					kind, p = f.policyForDecl(decl, visited)
+				}
+			}
+			return kind == ""
+		})
+		if kind != "" {
+			return kind, p
+		}
+	}
+	return "", 0
+}
+
+// Split returns a File for each source file that the declarations in f come
+// from, keyed by file name, with the imports and diagnostics of each. Source
+// files are known from positions, as recorded by NewPackage or WithFileSet;
+// declarations without a position are keyed by "". Each File can refer to the
+// declarations of the others, as in a Go package.
+func (f *File) Split() map[string]*File {
+	files := make(map[string]*File)
+	for _, t := range f.Code {
+		var name string
+		if pos := t.GetPos(); pos != nil {
+			name = pos.Filename
+		}
+		sf, ok := files[name]
+		if !ok {
+			c := *f
+			c.Code, c.Diagnostics, c.pkgCode = nil, nil, f.declarations()
+			sf = &c
+			files[name] = sf
+		}
+		sf.Code = append(sf.Code, t)
+	}
+	for name, sf := range files {
+		sf.Imports = f.usedImports(sf.Code)
+		for _, d := range f.Diagnostics {
+			if d.Pos != nil && d.Pos.Filename == name {
+				sf.Diagnostics = append(sf.Diagnostics, d)
+			}
+		}
+	}
+	return files
+}
+
+// declarations returns the declarations that the code in f can refer to,
+// which for a File returned by Split are those of the whole package.
+func (f *File) declarations() []Type {
+	if f.pkgCode != nil {
+		return f.pkgCode
+	}
+	return f.Code
+}
+
+// decl returns the type declared in the file with the given name, or nil.
+func (f *File) decl(name string) Type {
+	for _, t := range f.declarations() {
+		if t.GetName() == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// withPolicies returns code without the declarations and struct fields that
+// are left out by a PolicySkip policy.
+func (f *File) withPolicies(code []Type) []Type {
+	out := make([]Type, 0, len(code))
+	for _, t := range code {
+		if kind, p := f.policyFor(t); kind != "" && p == PolicySkip {
+			continue
+		}
+		if st, ok := t.(*StructType); ok {
+			t = f.structWithPolicies(st)
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+func (f *File) structWithPolicies(st *StructType) *StructType {
+	c := *st
+	c.Fields = nil
+	for _, field := range st.Fields {
+		if kind, p := f.policyFor(field.Type); kind != "" && p == PolicySkip {
+			continue
+		}
+		if nested, ok := field.Type.(*StructType); ok {
+			c := *field
+			c.Type = f.structWithPolicies(nested)
+			field = &c
+		}
+		c.Fields = append(c.Fields, field)
+	}
+	return &c
+}
+
+// checkPolicies returns an error for the first declaration or struct field
+// in code that is rejected by a PolicyError policy. path is the name of the
+// struct that code are the fields of, followed by a dot.
+func (f *File) checkPolicies(code []Type, path string) error {
+	for _, t := range code {
+		if kind, p := f.policyFor(t); kind != "" && p == PolicyError {
+			return fmt.Errorf("%s%s: %s types are not supported", posPrefix(t), path+t.GetName(), kind)
+		}
+		if st, ok := t.(*StructType); ok {
+			fields := make([]Type, len(st.Fields))
+			for i, field := range st.Fields {
+				fields[i] = field.Type
+			}
+			if err := f.checkPolicies(fields, path+st.Name+"."); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 type Import struct {
 	Name    string `json:"name,omitempty"`
 	Path    string `json:"path"`
 	oldPath string
-	used    bool
 }
 
 func (i *Import) Reflect() json.RawMessage {
@@ -81,8 +262,10 @@ func (i *Import) GetOldPath() string {
 }
 
 type PlainType struct {
-	Name string `json:"name"`
-	Type string `json:"type"`
+	Name        string       `json:"name"`
+	Type        *TypeRef     `json:"type"`
+	Constraints *Constraints `json:"constraints,omitempty"`
+	Meta
 	Docs string `json:"-"`
 }
 
@@ -91,23 +274,34 @@ func (p *PlainType) Reflect() json.RawMessage {
 	return injectKind(string(raw), "plain")
 }
 
+// ArrayType is a slice, or an array if Length or LengthExpr is set. LengthExpr
+// holds the length of an array when it cannot be evaluated, such as when it
+// refers to an imported constant.
 type ArrayType struct {
-	Name   string `json:"name"`
-	Type   string `json:"type"`
-	Length int    `json:"length,omitempty"`
-	Docs   string `json:"-"`
+	Name        string       `json:"name"`
+	Type        *TypeRef     `json:"type"`
+	Length      int          `json:"length,omitempty"`
+	LengthExpr  string       `json:"length_expr,omitempty"`
+	Constraints *Constraints `json:"constraints,omitempty"`
+	Meta
+	Docs string `json:"-"`
 }
 
 func (a *ArrayType) Reflect() json.RawMessage {
 	raw, _ := json.Marshal(a)
+	if a.Length > 0 {
+		raw = append(raw[:len(raw)-1], fmt.Sprintf(`,"min_items":%d,"max_items":%d}`, a.Length, a.Length)...)
+	}
 	return injectKind(string(raw), "array")
 }
 
 type MapType struct {
-	Name      string `json:"name"`
-	KeyType   string `json:"key_type"`
-	ValueType string `json:"value_type"`
-	Docs      string `json:"-"`
+	Name        string       `json:"name"`
+	KeyType     *TypeRef     `json:"key_type"`
+	ValueType   *TypeRef     `json:"value_type"`
+	Constraints *Constraints `json:"constraints,omitempty"`
+	Meta
+	Docs string `json:"-"`
 }
 
 func (m *MapType) Reflect() json.RawMessage {
@@ -118,7 +312,8 @@ func (m *MapType) Reflect() json.RawMessage {
 type StructType struct {
 	Name   string   `json:"name"`
 	Fields []*Field `json:"fields"`
-	Docs   string   `json:"-"`
+	Meta
+	Docs string `json:"-"`
 }
 
 func (s *StructType) Reflect() json.RawMessage {
@@ -126,18 +321,193 @@ func (s *StructType) Reflect() json.RawMessage {
 	for i, f := range s.Fields {
 		fields[i] = string(f.Reflect())
 	}
+	var extra string
+	if len(s.TypeParams) > 0 {
+		raw, _ := json.Marshal(s.TypeParams)
+		extra += fmt.Sprintf(`,"type_params":%s`, raw)
+	}
+	if s.Alias {
+		extra += `,"alias":true`
+	}
+	if len(s.Markers) > 0 {
+		raw, _ := json.Marshal(s.Markers)
+		extra += fmt.Sprintf(`,"markers":%s`, raw)
+	}
+	if len(s.Directives) > 0 {
+		raw, _ := json.Marshal(s.Directives)
+		extra += fmt.Sprintf(`,"directives":%s`, raw)
+	}
+	if s.Comment != "" {
+		raw, _ := json.Marshal(s.Comment)
+		extra += fmt.Sprintf(`,"comment":%s`, raw)
+	}
+	if s.Pos != nil {
+		raw, _ := json.Marshal(s.Pos)
+		extra += fmt.Sprintf(`,"pos":%s`, raw)
+	}
 	return json.RawMessage(
 		fmt.Sprintf(
-			`{"kind":"struct","name":"%s","fields":[%s]}`,
-			s.Name, strings.Join(fields, ","),
+			`{"kind":"struct","name":"%s","fields":[%s]%s}`,
+			s.Name, strings.Join(fields, ","), extra,
 		),
 	)
 }
 
+type FuncType struct {
+	Name    string   `json:"name"`
+	Params  []*Param `json:"params,omitempty"`
+	Results []*Param `json:"results,omitempty"`
+	Meta
+	Docs string `json:"-"`
+}
+
+func (fn *FuncType) Reflect() json.RawMessage {
+	raw, _ := json.Marshal(fn)
+	return injectKind(string(raw), "func")
+}
+
+type ChanType struct {
+	Name string   `json:"name"`
+	Type *TypeRef `json:"type"`
+	Dir  ChanDir  `json:"dir"`
+	Meta
+	Docs string `json:"-"`
+}
+
+func (c *ChanType) Reflect() json.RawMessage {
+	raw, _ := json.Marshal(c)
+	return injectKind(string(raw), "chan")
+}
+
+// Meta is what every type declaration and field has besides its name, type
+// and docs. Each node embeds it, which gives it the methods of Type that read
+// it.
+type Meta struct {
+	TypeParams []*TypeParam      `json:"type_params,omitempty"`
+	Alias      bool              `json:"alias,omitempty"`
+	Markers    []*Marker         `json:"markers,omitempty"`
+	Directives map[string]string `json:"directives,omitempty"`
+	Comment    string            `json:"comment,omitempty"`
+	Pos        *Position         `json:"pos,omitempty"`
+}
+
+func (m *Meta) GetComment() string               { return m.Comment }
+func (m *Meta) GetMarkers() []*Marker            { return m.Markers }
+func (m *Meta) GetDirectives() map[string]string { return m.Directives }
+func (m *Meta) GetPos() *Position                { return m.Pos }
+func (m *Meta) GetTypeParams() []*TypeParam      { return m.TypeParams }
+func (m *Meta) IsAlias() bool                    { return m.Alias }
+func (m *Meta) meta() *Meta                      { return m }
+
+// Position is the location of a node in its source file. It is only set when
+// the file set of the file is given to NewFile with WithFileSet.
+type Position struct {
+	Filename string
+	Line     int
+	Column   int
+	pos      token.Pos
+}
+
+// String renders p as "file:line:column", as in compiler errors.
+func (p *Position) String() string {
+	if p == nil || p.Line == 0 {
+		return "-"
+	}
+	s := fmt.Sprintf("%d:%d", p.Line, p.Column)
+	if p.Filename != "" {
+		s = p.Filename + ":" + s
+	}
+	return s
+}
+
+func (p *Position) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Position) resolve(fset *token.FileSet) {
+	pos := fset.Position(p.pos)
+	p.Filename, p.Line, p.Column = pos.Filename, pos.Line, pos.Column
+}
+
+// posPrefix returns the position of t followed by a colon, to prefix errors
+// and log lines with, or nothing if t has no position.
+func posPrefix(t Type) string {
+	if t.GetPos() == nil {
+		return ""
+	}
+	return t.GetPos().String() + ": "
+}
+
+// ChanDir is the direction of a channel type.
+type ChanDir int
+
+const (
+	ChanBoth ChanDir = iota
+	ChanSend
+	ChanRecv
+)
+
+func (d ChanDir) String() string {
+	switch d {
+	case ChanSend:
+		return "send"
+	case ChanRecv:
+		return "recv"
+	}
+	return "both"
+}
+
+func (d ChanDir) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+type InterfaceType struct {
+	Name    string     `json:"name"`
+	Methods []*Method  `json:"methods,omitempty"`
+	Embeds  []*TypeRef `json:"embeds,omitempty"`
+	Meta
+	Docs string `json:"-"`
+}
+
+func (it *InterfaceType) Reflect() json.RawMessage {
+	raw, _ := json.Marshal(it)
+	return injectKind(string(raw), "interface")
+}
+
+// Method is a method of an InterfaceType. Unlike other nodes, it includes its
+// docs in its JSON representation, for tools that generate code from them.
+type Method struct {
+	Name    string    `json:"name"`
+	Params  []*Param  `json:"params,omitempty"`
+	Results []*Param  `json:"results,omitempty"`
+	Docs    string    `json:"docs,omitempty"`
+	Comment string    `json:"comment,omitempty"`
+	Pos     *Position `json:"pos,omitempty"`
+}
+
+// Param is a parameter or result of a function signature. Name is empty for
+// unnamed parameters, and Type holds the element type of a variadic one.
+type Param struct {
+	Name     string   `json:"name,omitempty"`
+	Type     *TypeRef `json:"type"`
+	Variadic bool     `json:"variadic,omitempty"`
+}
+
+// TypeParam is a type parameter of a generic type declaration, e.g. the
+// "T any" in "type Page[T any] struct{...}".
+type TypeParam struct {
+	Name       string   `json:"name"`
+	Constraint *TypeRef `json:"constraint"`
+}
+
+// EnumType is a type declaration with a group of constants of that type. Type
+// is its underlying type, or nil for a string.
 type EnumType struct {
-	Name   string   `json:"name"`
-	Values []string `json:"values"`
-	Docs   string   `json:"-"`
+	Name   string       `json:"name"`
+	Type   *TypeRef     `json:"type,omitempty"`
+	Values []*EnumValue `json:"values"`
+	Meta
+	Docs string `json:"-"`
 }
 
 func (et *EnumType) Reflect() json.RawMessage {
@@ -145,42 +515,296 @@ func (et *EnumType) Reflect() json.RawMessage {
 	return injectKind(string(raw), "enum")
 }
 
-func (p *PlainType) GetName() string  { return p.Name }
-func (a *ArrayType) GetName() string  { return a.Name }
-func (m *MapType) GetName() string    { return m.Name }
-func (s *StructType) GetName() string { return s.Name }
-func (et *EnumType) GetName() string  { return et.Name }
+func (p *PlainType) GetName() string      { return p.Name }
+func (a *ArrayType) GetName() string      { return a.Name }
+func (m *MapType) GetName() string        { return m.Name }
+func (s *StructType) GetName() string     { return s.Name }
+func (et *EnumType) GetName() string      { return et.Name }
+func (fn *FuncType) GetName() string      { return fn.Name }
+func (c *ChanType) GetName() string       { return c.Name }
+func (it *InterfaceType) GetName() string { return it.Name }
+
+func (p *PlainType) GetTypeNames() []string      { return typeNames(p) }
+func (a *ArrayType) GetTypeNames() []string      { return typeNames(a) }
+func (m *MapType) GetTypeNames() []string        { return typeNames(m) }
+func (s *StructType) GetTypeNames() []string     { return typeNames(s) }
+func (et *EnumType) GetTypeNames() []string      { return []string{et.Name} }
+func (fn *FuncType) GetTypeNames() []string      { return typeNames(fn) }
+func (c *ChanType) GetTypeNames() []string       { return typeNames(c) }
+func (it *InterfaceType) GetTypeNames() []string { return typeNames(it) }
+
+func (p *PlainType) SetTypeNames(tt []string)      { setTypeNames(p, tt) }
+func (a *ArrayType) SetTypeNames(tt []string)      { setTypeNames(a, tt) }
+func (m *MapType) SetTypeNames(tt []string)        { setTypeNames(m, tt) }
+func (s *StructType) SetTypeNames(tt []string)     { setTypeNames(s, tt) }
+func (et *EnumType) SetTypeNames(typs []string)    { et.Name = typs[0] }
+func (fn *FuncType) SetTypeNames(tt []string)      { setTypeNames(fn, tt) }
+func (c *ChanType) SetTypeNames(tt []string)       { setTypeNames(c, tt) }
+func (it *InterfaceType) SetTypeNames(tt []string) { setTypeNames(it, tt) }
+
+func (p *PlainType) GetTypeRefs() []*TypeRef { return []*TypeRef{p.Type} }
+func (a *ArrayType) GetTypeRefs() []*TypeRef { return []*TypeRef{a.Type} }
+func (m *MapType) GetTypeRefs() []*TypeRef   { return []*TypeRef{m.KeyType, m.ValueType} }
+func (et *EnumType) GetTypeRefs() []*TypeRef {
+	if et.Type == nil {
+		return nil
+	}
+	return []*TypeRef{et.Type}
+}
+func (c *ChanType) GetTypeRefs() []*TypeRef { return []*TypeRef{c.Type} }
+
+func (p *PlainType) SetTypeRefs(tt []*TypeRef) { p.Type = tt[0] }
+func (a *ArrayType) SetTypeRefs(tt []*TypeRef) { a.Type = tt[0] }
+func (m *MapType) SetTypeRefs(tt []*TypeRef)   { m.KeyType = tt[0]; m.ValueType = tt[1] }
+func (et *EnumType) SetTypeRefs(tt []*TypeRef) {
+	if len(tt) > 0 {
+		et.Type = tt[0]
+	}
+}
+func (c *ChanType) SetTypeRefs(tt []*TypeRef) { c.Type = tt[0] }
+
+func (s *StructType) GetTypeRefs() []*TypeRef {
+	var typs []*TypeRef
+	for _, f := range s.Fields {
+		typs = append(typs, f.GetTypeRefs()...)
+	}
+	return typs
+}
+
+func (s *StructType) SetTypeRefs(tt []*TypeRef) {
+	for _, f := range s.Fields {
+		n := len(f.GetTypeRefs())
+		f.SetTypeRefs(tt[:n])
+		tt = tt[n:]
+	}
+}
 
-func (p *PlainType) GetTypeNames() []string  { return []string{p.Type} }
-func (a *ArrayType) GetTypeNames() []string  { return []string{a.Type} }
-func (m *MapType) GetTypeNames() []string    { return []string{m.KeyType, m.ValueType} }
-func (s *StructType) GetTypeNames() []string { panic("not implemented") }
-func (et *EnumType) GetTypeNames() []string  { return []string{et.Name} }
+func (fn *FuncType) GetTypeRefs() []*TypeRef {
+	var typs []*TypeRef
+	for _, p := range joinParams(fn.Params, fn.Results) {
+		typs = append(typs, p.Type)
+	}
+	return typs
+}
 
-func (p *PlainType) SetTypeNames(tt []string)   { p.Type = tt[0] }
-func (a *ArrayType) SetTypeNames(tt []string)   { a.Type = tt[0] }
-func (m *MapType) SetTypeNames(tt []string)     { m.KeyType = tt[0]; m.ValueType = tt[1] }
-func (s *StructType) SetTypeNames(tt []string)  { panic("not implemented") }
-func (et *EnumType) SetTypeNames(typs []string) { et.Name = typs[0] }
+func (fn *FuncType) SetTypeRefs(tt []*TypeRef) {
+	for i, p := range joinParams(fn.Params, fn.Results) {
+		p.Type = tt[i]
+	}
+}
 
-func (p *PlainType) GetDocs() string  { return p.Docs }
-func (a *ArrayType) GetDocs() string  { return a.Docs }
-func (m *MapType) GetDocs() string    { return m.Docs }
-func (s *StructType) GetDocs() string { return s.Docs }
-func (et *EnumType) GetDocs() string  { return et.Docs }
+func (it *InterfaceType) GetTypeRefs() []*TypeRef {
+	typs := append([]*TypeRef(nil), it.Embeds...)
+	for _, m := range it.Methods {
+		for _, p := range joinParams(m.Params, m.Results) {
+			typs = append(typs, p.Type)
+		}
+	}
+	return typs
+}
 
+func (it *InterfaceType) SetTypeRefs(tt []*TypeRef) {
+	copy(it.Embeds, tt)
+	tt = tt[len(it.Embeds):]
+	for _, m := range it.Methods {
+		for _, p := range joinParams(m.Params, m.Results) {
+			p.Type, tt = tt[0], tt[1:]
+		}
+	}
+}
+
+func (p *PlainType) GetDocs() string      { return p.Docs }
+func (a *ArrayType) GetDocs() string      { return a.Docs }
+func (m *MapType) GetDocs() string        { return m.Docs }
+func (s *StructType) GetDocs() string     { return s.Docs }
+func (et *EnumType) GetDocs() string      { return et.Docs }
+func (fn *FuncType) GetDocs() string      { return fn.Docs }
+func (c *ChanType) GetDocs() string       { return c.Docs }
+func (it *InterfaceType) GetDocs() string { return it.Docs }
+
+func (p *PlainType) setName(name string)      { p.Name = name }
+func (a *ArrayType) setName(name string)      { a.Name = name }
+func (m *MapType) setName(name string)        { m.Name = name }
+func (s *StructType) setName(name string)     { s.Name = name }
+func (et *EnumType) setName(name string)      { et.Name = name }
+func (fn *FuncType) setName(name string)      { fn.Name = name }
+func (c *ChanType) setName(name string)       { c.Name = name }
+func (it *InterfaceType) setName(name string) { it.Name = name }
+
+func (p *PlainType) setDocs(docs string)      { p.Docs = docs }
+func (a *ArrayType) setDocs(docs string)      { a.Docs = docs }
+func (m *MapType) setDocs(docs string)        { m.Docs = docs }
+func (s *StructType) setDocs(docs string)     { s.Docs = docs }
+func (et *EnumType) setDocs(docs string)      { et.Docs = docs }
+func (fn *FuncType) setDocs(docs string)      { fn.Docs = docs }
+func (c *ChanType) setDocs(docs string)       { c.Docs = docs }
+func (it *InterfaceType) setDocs(docs string) { it.Docs = docs }
+
+// Description returns the docs of t without comment markers, or its trailing
+// comment if it has no docs, for emitters that describe types in prose.
+func Description(t Type) string {
+	if desc := commentText(t.GetDocs()); desc != "" {
+		return desc
+	}
+	return commentText(t.GetComment())
+}
+
+func commentText(comment string) string {
+	var lines []string
+	for _, line := range strings.Split(comment, "\n") {
+		line = strings.TrimSpace(line)
+		line = strings.TrimPrefix(line, "//")
+		line = strings.TrimPrefix(line, "/*")
+		line = strings.TrimSuffix(line, "*/")
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// Field is a field of a StructType. An embedded field is named after its type,
+// as in Go. OneOf holds the wrapper types of a protobuf oneof field, one of
+// which its value is (see WithProtobuf), and Constraints the rules of its
+// validate tag.
 type Field struct {
 	Type
-	Tags *structtag.Tags
+	Tags        *structtag.Tags
+	Embedded    bool
+	OneOf       []*TypeRef
+	Constraints *Constraints
+
+	// jsonString is set on fields with the string option (see
+	// WithEncodingJSON), which encodes those of basic types in a JSON string.
+	jsonString bool
+	// inlineMap is set on map fields whose entries are inlined in their
+	// struct (see WithNameTag).
+	inlineMap bool
 }
 
 func (f *Field) Reflect() json.RawMessage {
 	raw := f.Type.Reflect()
 	var tags []string
-	for _, t := range f.Tags.Tags() {
+	for _, t := range f.tags() {
 		tags = append(tags, fmt.Sprintf(`"%s":"%s"`, t.Key, t.Name))
 	}
-	return json.RawMessage(fmt.Sprintf(`%s,"tags":{%s}}`, raw[:len(raw)-1], strings.Join(tags, ",")))
+	var embedded string
+	if f.Embedded {
+		embedded = `,"embedded":true`
+	}
+	if len(f.OneOf) > 0 {
+		oneOf, _ := json.Marshal(f.OneOf)
+		embedded += `,"one_of":` + string(oneOf)
+	}
+	if f.Constraints != nil {
+		constraints, _ := json.Marshal(f.Constraints)
+		embedded += `,"constraints":` + string(constraints)
+	}
+	return json.RawMessage(fmt.Sprintf(`%s%s,"tags":{%s}}`, raw[:len(raw)-1], embedded, strings.Join(tags, ",")))
+}
+
+func (f *Field) tags() []*structtag.Tag {
+	if f.Tags == nil {
+		return nil
+	}
+	return f.Tags.Tags()
+}
+
+func (f *Field) tag(key string) *structtag.Tag {
+	if f.Tags == nil {
+		return nil
+	}
+	t, _ := f.Tags.Get(key)
+	return t
+}
+
+// cloneType returns a deep copy of t that can be modified without affecting
+// the original.
+func cloneType(t Type) Type {
+	switch tt := t.(type) {
+	case *PlainType:
+		c := *tt
+		return withClonedRefs(&c)
+	case *ArrayType:
+		c := *tt
+		return withClonedRefs(&c)
+	case *MapType:
+		c := *tt
+		return withClonedRefs(&c)
+	case *StructType:
+		c := *tt
+		c.Fields = make([]*Field, len(tt.Fields))
+		for i, f := range tt.Fields {
+			cf := *f
+			cf.Type = cloneType(f.Type)
+			c.Fields[i] = &cf
+		}
+		return withClonedRefs(&c)
+	case *EnumType:
+		c := *tt
+		c.Values = make([]*EnumValue, len(tt.Values))
+		for i, v := range tt.Values {
+			cv := *v
+			c.Values[i] = &cv
+		}
+		return withClonedRefs(&c)
+	case *FuncType:
+		c := *tt
+		c.Params = cloneParams(tt.Params)
+		c.Results = cloneParams(tt.Results)
+		return withClonedRefs(&c)
+	case *ChanType:
+		c := *tt
+		return withClonedRefs(&c)
+	case *InterfaceType:
+		c := *tt
+		c.Embeds = append([]*TypeRef(nil), tt.Embeds...)
+		c.Methods = make([]*Method, len(tt.Methods))
+		for i, m := range tt.Methods {
+			cm := *m
+			cm.Params = cloneParams(m.Params)
+			cm.Results = cloneParams(m.Results)
+			c.Methods[i] = &cm
+		}
+		return withClonedRefs(&c)
+	}
+	return t
+}
+
+// withClonedRefs replaces the type references in t with copies.
+func withClonedRefs(t Type) Type {
+	t.SetTypeRefs(substRefs(t.GetTypeRefs(), nil))
+	return t
+}
+
+func cloneTags(tags *structtag.Tags) *structtag.Tags {
+	c := &structtag.Tags{}
+	if tags == nil {
+		return c
+	}
+	// Tags are copied rather than parsed back from their string, which
+	// loses empty options, as in json:"-,".
+	for _, tag := range tags.Tags() {
+		t := *tag
+		t.Options = append([]string(nil), tag.Options...)
+		c.Set(&t)
+	}
+	return c
+}
+
+// joinParams returns the params followed by the results of a signature.
+func joinParams(params, results []*Param) []*Param {
+	return append(append([]*Param(nil), params...), results...)
+}
+
+func cloneParams(params []*Param) []*Param {
+	if params == nil {
+		return nil
+	}
+	c := make([]*Param, len(params))
+	for i, p := range params {
+		cp := *p
+		c[i] = &cp
+	}
+	return c
 }
 
 func injectKind(raw string, kind string) json.RawMessage {
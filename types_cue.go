@@ -2,15 +2,33 @@ package toast
 
 import (
 	"fmt"
+	"go/ast"
+	"regexp"
 	"sort"
 	"strings"
+
+	"github.com/fatih/structtag"
 )
 
 func (f *File) CUE() string {
 	var imports, code string
+	for _, t := range f.cueCode() {
+		code += t.GetDocs() + withComment(t, t.CUE()) + "\n"
+	}
+	// Imports are only kept if referenced, as types that have no CUE
+	// equivalent or that are inlined leave some of them unused.
 	impSlice := make([]string, 0, len(f.Imports))
-	for _, i := range f.Imports {
-		impSlice = append(impSlice, i.CUE())
+	imported := make(map[string]bool)
+	for name, i := range f.Imports {
+		if regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\.#`).MatchString(code) {
+			impSlice = append(impSlice, i.CUE())
+			imported[name] = true
+		}
+	}
+	for _, pkg := range cueBuiltins {
+		if !imported[pkg] && regexp.MustCompile(`\b`+pkg+`\.[A-Z]`).MatchString(code) {
+			impSlice = append(impSlice, (&Import{Path: pkg}).CUE())
+		}
 	}
 	sort.Strings(impSlice)
 	for _, imp := range impSlice {
@@ -19,13 +37,356 @@ func (f *File) CUE() string {
 	if len(imports) > 0 {
 		imports = fmt.Sprintf("import (\n%s)\n\n", imports)
 	}
-	for _, t := range f.Code {
-		code += t.GetDocs() + t.CUE() + "\n"
-	}
 	src := []byte(fmt.Sprintf("package %s\n\n%s%s", f.cuePkgName, imports, code))
 	return string(src)[:len(src)-1]
 }
 
+// cueCode returns the code to render as CUE. CUE has no generics, so each
+// generic declaration is rendered with its type parameters bound to their
+// constraints, and each instantiation referenced in the file is expanded into
+// a definition of its own, e.g. Page[User] becomes #Page_User.
+func (f *File) cueCode() []Type {
+	code := f.withPolicies(f.Code)
+	for _, t := range code {
+		if st, ok := t.(*StructType); ok {
+			if f.protobuf {
+				protoJSONFields(st)
+			}
+			if len(f.nameTags) > 0 {
+				f.nameFields(st, f.nameTags)
+			}
+			f.promoteEmbedded(st)
+			if f.encodingJSON {
+				jsonFields(st)
+			}
+		}
+	}
+	if f.cueInlineAliases {
+		code = inlineAliases(code)
+	}
+	generics := make(map[string]Type)
+	for _, t := range append(f.withPolicies(f.declarations()), code...) {
+		if len(t.GetTypeParams()) > 0 {
+			generics[t.GetName()] = t
+		}
+	}
+	if len(generics) == 0 {
+		return code
+	}
+
+	for i, t := range code {
+		if tps := t.GetTypeParams(); len(tps) > 0 {
+			subst := make(map[string]*TypeRef, len(tps))
+			for _, tp := range tps {
+				subst[tp.Name] = typeFromConstraint(tp.Constraint)
+			}
+			code[i] = instantiate(t, t.GetName(), t.GetDocs(), subst)
+		}
+	}
+
+	expanded := make(map[string]bool)
+	for i := 0; i < len(code); i++ {
+		for _, ref := range code[i].GetTypeRefs() {
+			ref.Walk(func(r *TypeRef) bool {
+				if r.Kind != RefNamed || r.Package != "" || len(r.Args) == 0 {
+					return true
+				}
+				name := instanceName(r.Name, r.Args)
+				g, ok := generics[r.Name]
+				if !ok || expanded[name] {
+					return true
+				}
+				expanded[name] = true
+				subst := make(map[string]*TypeRef)
+				for j, tp := range g.GetTypeParams() {
+					if j < len(r.Args) {
+						subst[tp.Name] = r.Args[j]
+					}
+				}
+				inst := &TypeRef{Kind: RefNamed, Name: r.Name, Args: r.Args}
+				code = append(code, instantiate(g, name, "// "+inst.String()+"\n", subst))
+				return true
+			})
+		}
+	}
+	return code
+}
+
+// inlineAliases leaves out the alias declarations in code, and replaces each
+// reference to them with the aliased type. Aliases of struct, function,
+// channel and interface types, and generic aliases, are kept as definitions.
+func inlineAliases(code []Type) []Type {
+	subst := make(map[string]*TypeRef)
+	for _, t := range code {
+		if !t.IsAlias() || len(t.GetTypeParams()) > 0 {
+			continue
+		}
+		switch tt := t.(type) {
+		case *PlainType:
+			subst[tt.Name] = tt.Type
+		case *ArrayType:
+			subst[tt.Name] = &TypeRef{Kind: RefSlice, Elem: tt.Type}
+			if tt.Length > 0 || tt.LengthExpr != "" {
+				subst[tt.Name] = &TypeRef{Kind: RefArray, Elem: tt.Type, Length: tt.Length, LengthExpr: tt.LengthExpr}
+			}
+		case *MapType:
+			subst[tt.Name] = &TypeRef{Kind: RefMap, Key: tt.KeyType, Value: tt.ValueType}
+		}
+	}
+	if len(subst) == 0 {
+		return code
+	}
+	for range subst {
+		for name, typ := range subst {
+			subst[name] = typ.Subst(subst)
+		}
+	}
+
+	out := make([]Type, 0, len(code))
+	for _, t := range code {
+		if _, ok := subst[t.GetName()]; ok && t.IsAlias() {
+			continue
+		}
+		t = cloneType(t)
+		t.SetTypeRefs(substRefs(t.GetTypeRefs(), subst))
+		out = append(out, t)
+	}
+	return out
+}
+
+// promoteEmbedded replaces the untagged embedded fields of st whose types are
+// declared in the file as something other than a struct, which encoding/json
+// does not promote. Exported ones become fields named after their type, and
+// unexported ones are dropped. st must be a copy, as returned by withPolicies.
+func (f *File) promoteEmbedded(st *StructType) {
+	var fields []*Field
+	for _, field := range st.Fields {
+		if nested, ok := field.Type.(*StructType); ok {
+			f.promoteEmbedded(nested)
+		}
+		if jsonTag := field.tag("json"); !field.Embedded || (jsonTag != nil && jsonTag.Name != "") {
+			fields = append(fields, field)
+			continue
+		}
+		if ref := field.GetTypeRefs()[0]; ref.Package != "" || f.decl(ref.Name) == nil {
+			fields = append(fields, field)
+		} else if _, ok := f.decl(ref.Name).(*StructType); ok {
+			fields = append(fields, field)
+		} else if name := field.GetName(); ast.IsExported(name) {
+			c := *field
+			c.Tags = cloneTags(field.Tags)
+			c.Tags.Set(&structtag.Tag{Key: "json", Name: name})
+			c.Embedded, c.OneOf = false, nil
+			fields = append(fields, &c)
+		}
+	}
+	st.Fields = fields
+}
+
+// nameFields replaces the json tag of each field of st with the first of the
+// tags with the given keys that it has, so that it is named after it. Fields
+// tagged "-" are left out. An inline or squash option, as in yaml and
+// mapstructure tags, makes a field of a named struct type embedded, promotes
+// the fields of an anonymous struct, and makes a map the pattern of the other
+// fields of st. st must be a copy, as returned by withPolicies.
+func (f *File) nameFields(st *StructType, keys []string) {
+	var fields []*Field
+	for _, field := range st.Fields {
+		nested, isStruct := field.Type.(*StructType)
+		if isStruct {
+			f.nameFields(nested, keys)
+		}
+		if field.GetDirectives()["name"] != "" {
+			// A name directive names the field in its json tag.
+			fields = append(fields, field)
+			continue
+		}
+		c := *field
+		c.Tags = cloneTags(field.Tags)
+		c.Tags.Delete("json")
+		if tag := nameTag(field, keys); tag != nil {
+			if tag.Name == "-" && len(tag.Options) == 0 {
+				continue
+			}
+			if tag.HasOption("inline") || tag.HasOption("squash") {
+				if isStruct {
+					fields = append(fields, nested.Fields...)
+					continue
+				}
+				if f.isStructRef(field.Type) {
+					c.Embedded, tag.Name = true, ""
+				} else if mt := f.mapType(field.Type); mt != nil {
+					c.Type, c.inlineMap = mt, true
+				}
+			}
+			c.Tags.Set(tag)
+		}
+		fields = append(fields, &c)
+	}
+	st.Fields = fields
+}
+
+// nameTag returns the first of the tags of field with the given keys, as a
+// json tag. A tag that does not name the field names it after the Go field,
+// lowercased for yaml, as yaml.v3 does, unless it is the json tag of an
+// embedded field, whose fields encoding/json promotes.
+func nameTag(field *Field, keys []string) *structtag.Tag {
+	for _, key := range keys {
+		tag := field.tag(key)
+		switch {
+		case tag == nil:
+			continue
+		case key == "protobuf":
+			if jsonTag := protoJSONTag(tag); jsonTag != nil {
+				return jsonTag
+			}
+			continue
+		}
+		name := tag.Name
+		switch {
+		case name != "" || key == "json" && field.Embedded:
+		case key == "yaml":
+			name = strings.ToLower(field.GetName())
+		default:
+			name = field.GetName()
+		}
+		return &structtag.Tag{Key: "json", Name: name, Options: tag.Options}
+	}
+	return nil
+}
+
+// isStructRef reports whether t refers to a named struct type, or to one of
+// another package, which is assumed to be a struct unless its underlying type
+// is known.
+func (f *File) isStructRef(t Type) bool {
+	pt, ok := t.(*PlainType)
+	if !ok || pt.Type.Kind != RefNamed {
+		return false
+	}
+	if pt.Type.Package != "" {
+		return pt.Type.Underlying == nil || pt.Type.Underlying.Kind == RefStruct
+	}
+	_, ok = f.decl(pt.Type.Name).(*StructType)
+	return ok
+}
+
+// mapType returns t as a MapType if it is a map, or refers to a map type
+// declared in the file, and nil otherwise.
+func (f *File) mapType(t Type) *MapType {
+	switch tt := t.(type) {
+	case *MapType:
+		return tt
+	case *PlainType:
+		ref := tt.Type
+		if ref.Kind == RefNamed && ref.Package == "" && !ref.Pointer {
+			if mt, ok := f.decl(ref.Name).(*MapType); ok {
+				return &MapType{Name: tt.Name, KeyType: mt.KeyType, ValueType: mt.ValueType, Docs: tt.Docs}
+			}
+		}
+		if ref.Kind == RefMap && !ref.Pointer {
+			return &MapType{Name: tt.Name, KeyType: ref.Key, ValueType: ref.Value, Docs: tt.Docs}
+		}
+	}
+	return nil
+}
+
+// jsonFields names the fields of st as encoding/json does: after the Go field
+// name if their json tag does not name them, leaving out those tagged "-" and
+// unexported ones. Fields with the string option are marked as such, to be
+// rendered as encoded in a JSON string if they are of a basic type once type
+// parameters are substituted. st must be a copy, as returned by withPolicies.
+func jsonFields(st *StructType) {
+	var fields []*Field
+	for _, field := range st.Fields {
+		if nested, ok := field.Type.(*StructType); ok {
+			jsonFields(nested)
+		}
+		jsonTag := field.tag("json")
+		if jsonTag != nil && jsonTag.Name == "-" && len(jsonTag.Options) == 0 {
+			continue
+		}
+		if field.Embedded {
+			fields = append(fields, field)
+			continue
+		}
+		name := field.GetName()
+		if !ast.IsExported(name) {
+			continue
+		}
+		c := *field
+		c.Tags = cloneTags(field.Tags)
+		if jsonTag == nil {
+			jsonTag = &structtag.Tag{Key: "json"}
+		}
+		if jsonTag.Name == "" {
+			c.Tags.Set(&structtag.Tag{Key: "json", Name: name, Options: jsonTag.Options})
+		}
+		c.jsonString = jsonTag.HasOption("string")
+		fields = append(fields, &c)
+	}
+	st.Fields = fields
+}
+
+// fmtJSONStringToCUE renders a basic type encoded in a JSON string, as with
+// the string option of encoding/json.
+func fmtJSONStringToCUE(r *TypeRef) string {
+	switch {
+	case r.Name == "bool":
+		return `"true" | "false"`
+	case r.Name == "string":
+		return "string"
+	case strings.HasPrefix(r.Name, "float"):
+		return `=~"^-?[0-9]+(\\.[0-9]+)?([eE][-+]?[0-9]+)?$"`
+	}
+	return `=~"^-?[0-9]+$"`
+}
+
+// instantiate returns a copy of the generic type t named name, with its type
+// parameters replaced according to subst.
+func instantiate(t Type, name, docs string, subst map[string]*TypeRef) Type {
+	inst := cloneType(t)
+	inst.SetTypeRefs(substRefs(inst.GetTypeRefs(), subst))
+	switch it := inst.(type) {
+	case *PlainType:
+		it.Name, it.Docs, it.TypeParams = name, docs, nil
+	case *ArrayType:
+		it.Name, it.Docs, it.TypeParams = name, docs, nil
+	case *MapType:
+		it.Name, it.Docs, it.TypeParams = name, docs, nil
+	case *StructType:
+		it.Name, it.Docs, it.TypeParams = name, docs, nil
+	case *FuncType:
+		it.Name, it.Docs, it.TypeParams = name, docs, nil
+	case *ChanType:
+		it.Name, it.Docs, it.TypeParams = name, docs, nil
+	case *InterfaceType:
+		it.Name, it.Docs, it.TypeParams = name, docs, nil
+	}
+	return inst
+}
+
+var nonIdentExpr = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// instanceName returns the name of the definition an instantiated generic
+// type expands to in CUE, e.g. Pair_string_int for Pair[string, int].
+func instanceName(base string, args []*TypeRef) string {
+	name := base
+	for _, arg := range args {
+		name += "_" + strings.Trim(nonIdentExpr.ReplaceAllString(arg.String(), "_"), "_")
+	}
+	return name
+}
+
+// typeFromConstraint returns the type a type parameter is bound to when its
+// generic declaration is rendered as CUE: the underlying type for a single
+// basic type constraint, and interface{} otherwise.
+func typeFromConstraint(constraint *TypeRef) *TypeRef {
+	if constraint.IsBasic() {
+		return &TypeRef{Kind: RefNamed, Name: constraint.Name}
+	}
+	return &TypeRef{Kind: RefInterface, Expr: "interface{}"}
+}
+
 func (i *Import) CUE() string {
 	if i.Name == "" {
 		return fmt.Sprintf("  \"%s\"\n", i.Path)
@@ -34,84 +395,167 @@ func (i *Import) CUE() string {
 }
 
 func (p *PlainType) CUE() string {
-	return fmt.Sprintf("#%s: %s\n", p.Name, fmtToCUE(p.Type))
+	str := fmtRefToCUE(p.Type)
+	if p.Constraints != nil {
+		str = fmtConstraintsToCUE(str, p.Constraints, p.Type.Kind == RefMap)
+	}
+	return fmt.Sprintf("#%s: %s\n", p.Name, str)
 }
 
 func (a *ArrayType) CUE() string {
-	if a.Type == "byte" {
-		return fmt.Sprintf("#%s: bytes\n", a.Name)
+	str := fmtArrayToCUE(a)
+	if a.Constraints != nil {
+		str = fmtConstraintsToCUE(str, a.Constraints, false)
+	}
+	return fmt.Sprintf("#%s: %s\n", a.Name, str)
+}
+
+func fmtArrayToCUE(a *ArrayType) string {
+	return fmtListToCUE(a.Type, a.Length, a.LengthExpr)
+}
+
+// fmtListToCUE renders a slice as an open list, or as bytes for a byte slice,
+// which encoding/json encodes as base64. Arrays with a known length render as
+// a list of exactly that many elements.
+func fmtListToCUE(elem *TypeRef, length int, lengthExpr string) string {
+	if length > 0 {
+		return fmt.Sprintf("list.MinItems(%d) & list.MaxItems(%d) & [...%s]", length, length, fmtRefToCUE(elem))
+	}
+	if lengthExpr == "" && elem.IsBasic() && elem.Name == "byte" && !elem.Pointer {
+		return "bytes"
 	}
-	return fmt.Sprintf("#%s: [...%s]\n", a.Name, fmtToCUE(a.Type))
+	return "[..." + fmtRefToCUE(elem) + "]"
 }
 
 func (m *MapType) CUE() string {
-	keyTyp := fmtToCUE(m.KeyType)
-	valTyp := fmtToCUE(m.ValueType)
-	return fmt.Sprintf("#%s: [%s]: %s\n", m.Name, keyTyp, valTyp)
+	keyTyp := fmtRefToCUE(m.KeyType)
+	valTyp := fmtRefToCUE(m.ValueType)
+	str := fmt.Sprintf("[%s]: %s", keyTyp, valTyp)
+	if m.Constraints != nil {
+		str = fmtConstraintsToCUE(str, m.Constraints, true)
+	}
+	return fmt.Sprintf("#%s: %s\n", m.Name, str)
 }
 
 func (s *StructType) CUE() string {
-	var fields string
-	for _, f := range s.Fields {
-		fields += f.CUE()
+	return fmt.Sprintf("#%s: {\n%s}\n", s.Name, fmtFieldsToCUE(s.Fields))
+}
+
+// fmtFieldsToCUE renders the fields of a struct. The pattern of a map inlined
+// in the struct leaves out the names of its other fields, which it would
+// otherwise constrain to the type of its values as well.
+func fmtFieldsToCUE(fields []*Field) string {
+	var names []string
+	for _, f := range fields {
+		if tag := f.tag("json"); tag != nil && tag.Name != "" && !f.inlineMap {
+			names = append(names, regexp.QuoteMeta(tag.Name))
+		}
+	}
+	var str string
+	for _, f := range fields {
+		mt, ok := f.Type.(*MapType)
+		if !ok || !f.inlineMap {
+			str += f.CUE()
+			continue
+		}
+		label := fmtRefToCUE(mt.KeyType)
+		if len(names) > 0 {
+			label = fmt.Sprintf("!~%q", "^("+strings.Join(names, "|")+")$")
+		}
+		str += mt.Docs + fmt.Sprintf("[%s]: %s%s\n", label, fmtRefToCUE(mt.ValueType), fmtTrailing(f.GetComment()))
 	}
-	return fmt.Sprintf("#%s: {\n%s}\n", s.Name, fields)
+	return str
 }
 
 func (et *EnumType) CUE() string {
 	values := make([]string, 0, len(et.Values))
 	for _, v := range et.Values {
-		values = append(values, `"`+v+`"`)
+		values = append(values, v.literal())
 	}
 	str := "#" + et.Name + ": " + strings.Join(values, " | ") + "\n\n"
 	for _, v := range et.Values {
-		str += fmt.Sprintf("%s_%s: \"%s\"\n", et.Name, v, v)
+		str += v.Docs + fmt.Sprintf("%s: %s%s\n", v.constName(et.Name), v.literal(), fmtTrailing(v.Comment))
 	}
 	return str
 }
 
+func (fn *FuncType) CUE() string {
+	return fmt.Sprintf("#%s: _\n", fn.Name)
+}
+
+func (c *ChanType) CUE() string {
+	return fmt.Sprintf("#%s: _\n", c.Name)
+}
+
+func (it *InterfaceType) CUE() string {
+	return fmt.Sprintf("#%s: _\n", it.Name)
+}
+
 func (f *Field) CUE() string {
-	ts := f.Tags.Tags()
-	if len(ts) == 0 {
+	if len(f.OneOf) > 0 {
+		// A oneof is inlined in JSON as the field of the wrapper it is set
+		// to, if any.
+		options := []string{"{}"}
+		for _, ref := range f.OneOf {
+			options = append(options, fmtRefToCUE(ref))
+		}
+		return f.Type.GetDocs() + strings.Join(options, " | ") + fmtTrailing(f.GetComment()) + "\n"
+	}
+	jsonTag := f.tag("json")
+	if jsonTag != nil && jsonTag.Name == "-" && len(jsonTag.Options) == 0 {
+		// encoding/json ignores the field, embedded or not.
 		return ""
 	}
-	jsonTag, _ := f.Tags.Get("json")
+	if f.Embedded && (jsonTag == nil || jsonTag.Name == "") {
+		// encoding/json promotes the fields of an embedded struct, which is
+		// what embedding a definition does in CUE.
+		return f.Type.GetDocs() + fmtRefToCUE(f.GetTypeRefs()[0]) + fmtTrailing(f.GetComment()) + "\n"
+	}
 	if jsonTag == nil {
 		return ""
 	}
 
 	name := jsonTag.Name
-	if jsonTag.HasOption("omitempty") {
+	if f.Constraints != nil && f.Constraints.Optional || jsonTag.HasOption("omitempty") && (f.Constraints == nil || !f.Constraints.Required) {
 		name += "?"
 	}
 
 	var str string
 	switch ft := f.Type.(type) {
 	case *PlainType:
-		str = fmtToCUE(ft.Type)
-	case *ArrayType:
-		if ft.Type == "byte" {
-			str = "bytes"
-		} else {
-			str = "[..." + fmtToCUE(ft.Type) + "]"
+		str = fmtRefToCUE(ft.Type)
+		if f.jsonString && ft.Type.IsBasic() {
+			str = fmtJSONStringToCUE(ft.Type)
 		}
+	case *ArrayType:
+		str = fmtArrayToCUE(ft)
 	case *MapType:
-		keyTyp := fmtToCUE(ft.KeyType)
-		valTyp := fmtToCUE(ft.ValueType)
+		keyTyp := fmtRefToCUE(ft.KeyType)
+		valTyp := fmtRefToCUE(ft.ValueType)
 		str = fmt.Sprintf("[%s]: %s", keyTyp, valTyp)
 	case *StructType:
-		var fields string
-		for _, f := range ft.Fields {
-			fields += f.CUE()
+		str = fmt.Sprintf("{\n%s}", fmtFieldsToCUE(ft.Fields))
+	case *FuncType, *ChanType, *InterfaceType:
+		str = "_"
+	}
+	if f.Constraints != nil {
+		_, isMap := f.Type.(*MapType)
+		if pt, ok := f.Type.(*PlainType); ok && pt.Type.Kind == RefMap {
+			isMap = true
 		}
-		str = fmt.Sprintf("{\n%s}", fields)
+		str = fmtConstraintsToCUE(str, f.Constraints, isMap)
 	}
+	str += fmtTrailing(f.GetComment())
 	if docs := f.Type.GetDocs(); docs != "" {
 		return fmt.Sprintf("%s%s: %s\n", docs, name, str)
 	}
 	return fmt.Sprintf("%s: %s\n", name, str)
 }
 
+// cueBuiltins are the CUE standard library packages the CUE output may use.
+// They are imported when referenced.
+var cueBuiltins = []string{"list", "strings", "struct", "time"}
+
 var basicTypes = map[string]bool{
 	"bool":      true,
 	"string":    true,
@@ -133,23 +577,48 @@ var basicTypes = map[string]bool{
 	"complex64": true,
 }
 
-func fmtToCUE(typ string) string {
-	typ = strings.Replace(typ, "*", "", 1)
-	if typ == "interface{}" || typ == "error" {
-		return "_"
-	}
-	if typ == "struct{}" {
-		return "{}"
-	}
-	if strings.HasPrefix(typ, "[]") {
-		typ = typ[2:]
-		return fmt.Sprintf("[...%s]", fmtToCUE(typ))
-	}
-	if strings.Contains(typ, ".") {
-		return strings.Replace(typ, ".", ".#", 1)
-	}
-	if !basicTypes[typ] && !strings.HasPrefix(typ, "#") {
-		return "#" + typ
+// fmtRefToCUE renders a type reference as CUE. Pointers render as the type
+// they point to, and types with no JSON representation render as top.
+func fmtRefToCUE(r *TypeRef) string {
+	switch r.Kind {
+	case RefNamed:
+		name := r.Name
+		if len(r.Args) > 0 {
+			name = instanceName(r.Name, r.Args)
+		}
+		switch {
+		case r.WellKnown != "":
+			return WellKnownTypes[r.Path+"."+r.Name].CUE
+		case r.Package != "" && r.Underlying != nil && r.Underlying.IsBasic():
+			// Known from type information, e.g. int64 for time.Duration.
+			return r.Underlying.Name
+		case r.Package != "":
+			return r.Package + ".#" + name
+		case name == "error" || name == "any":
+			return "_"
+		case basicTypes[name] || strings.HasPrefix(name, "#"):
+			return name
+		}
+		return "#" + name
+	case RefPointer:
+		return fmtRefToCUE(r.Elem)
+	case RefSlice:
+		return fmtListToCUE(r.Elem, 0, "")
+	case RefArray:
+		return fmtListToCUE(r.Elem, r.Length, r.LengthExpr)
+	case RefMap:
+		return fmt.Sprintf("{[%s]: %s}", fmtRefToCUE(r.Key), fmtRefToCUE(r.Value))
+	case RefStruct:
+		if r.Expr == "struct{}" {
+			return "{}"
+		}
+		return "{...}"
+	case RefUnion:
+		terms := make([]string, len(r.Terms))
+		for i, term := range r.Terms {
+			terms[i] = fmtRefToCUE(term)
+		}
+		return strings.Join(terms, " | ")
 	}
-	return typ
+	return "_"
 }
@@ -23,7 +23,7 @@ func (f *File) Go() string {
 		imports = fmt.Sprintf("import (\n%s)\n\n", imports)
 	}
 	for _, t := range f.Code {
-		code += t.GetDocs() + t.Go() + "\n"
+		code += t.GetDocs() + fmtMarkers(t) + withComment(t, t.Go()) + "\n"
 	}
 	src := []byte(fmt.Sprintf("package %s\n\n%s%s", f.pkgName, imports, code))
 	if f.debug {
@@ -40,19 +40,21 @@ func (i *Import) Go() string {
 }
 
 func (p *PlainType) Go() string {
-	return fmt.Sprintf("type %s %s\n", p.Name, p.Type)
+	return fmt.Sprintf("type %s%s %s\n", p.Name, fmtTypeSpec(p.TypeParams, p.Alias), p.Type)
 }
 
 func (a *ArrayType) Go() string {
 	brackets := "[]"
 	if a.Length > 0 {
 		brackets = fmt.Sprintf("[%d]", a.Length)
+	} else if a.LengthExpr != "" {
+		brackets = "[" + a.LengthExpr + "]"
 	}
-	return fmt.Sprintf("type %s %s%s\n", a.Name, brackets, a.Type)
+	return fmt.Sprintf("type %s%s %s%s\n", a.Name, fmtTypeSpec(a.TypeParams, a.Alias), brackets, a.Type)
 }
 
 func (m *MapType) Go() string {
-	return fmt.Sprintf("type %s map[%s]%s\n", m.Name, m.KeyType, m.ValueType)
+	return fmt.Sprintf("type %s%s map[%s]%s\n", m.Name, fmtTypeSpec(m.TypeParams, m.Alias), m.KeyType, m.ValueType)
 }
 
 func (s *StructType) Go() string {
@@ -60,36 +62,143 @@ func (s *StructType) Go() string {
 	for _, f := range s.Fields {
 		fields += f.Go()
 	}
-	return fmt.Sprintf("type %s struct {\n%s}\n", s.Name, fields)
+	return fmt.Sprintf("type %s%s struct {\n%s}\n", s.Name, fmtTypeSpec(s.TypeParams, s.Alias), fields)
 }
 
 func (et *EnumType) Go() string {
-	str := fmt.Sprintf("type %s string\n\nconst (\n", et.Name)
+	typ := "string"
+	if et.Type != nil {
+		typ = et.Type.String()
+	}
+	str := fmt.Sprintf("type %s%s %s\n\nconst (\n", et.Name, fmtTypeSpec(nil, et.Alias), typ)
 	for _, v := range et.Values {
-		str += fmt.Sprintf("  %s_%s = \"%s\"\n", et.Name, v, v)
+		typ := " " + et.Name
+		if v.Value == nil {
+			typ = ""
+		}
+		str += v.Docs + fmt.Sprintf("  %s%s = %s%s\n", v.constName(et.Name), typ, v.literal(), fmtTrailing(v.Comment))
 	}
 	str += ")\n"
 	return str
 }
 
-func (f *Field) Go() string {
-	ts := f.Tags.Tags()
-	tags := make([]string, len(ts))
-	for _, t := range ts {
-		tags = append(tags, fmt.Sprintf("%s:\"%s\"", t.Key, t.Name))
+func (fn *FuncType) Go() string {
+	return fmt.Sprintf("type %s%s func%s\n", fn.Name, fmtTypeSpec(fn.TypeParams, fn.Alias), fmtSignature(fn.Params, fn.Results))
+}
+
+func (c *ChanType) Go() string {
+	return fmt.Sprintf("type %s%s %s\n", c.Name, fmtTypeSpec(c.TypeParams, c.Alias), fmtChan(c.Dir, c.Type.String()))
+}
+
+func (it *InterfaceType) Go() string {
+	var elems string
+	for _, e := range it.Embeds {
+		elems += e.String() + "\n"
+	}
+	if len(it.Embeds) > 0 && len(it.Methods) > 0 {
+		elems += "\n"
+	}
+	for _, m := range it.Methods {
+		elems += m.Docs + m.Name + fmtSignature(m.Params, m.Results) + fmtTrailing(m.Comment) + "\n"
+	}
+	if elems == "" {
+		return fmt.Sprintf("type %s%s interface{}\n", it.Name, fmtTypeSpec(it.TypeParams, it.Alias))
 	}
+	return fmt.Sprintf("type %s%s interface {\n%s}\n", it.Name, fmtTypeSpec(it.TypeParams, it.Alias), elems)
+}
+
+func (f *Field) Go() string {
 	var tag string
-	if len(ts) > 0 {
-		tag = "`" + strings.TrimSpace(strings.Join(tags, " ")) + "`"
+	if len(f.tags()) > 0 {
+		tag = "`" + f.Tags.String() + "`"
 	}
 	str := f.Type.Go()
 	str = strings.Replace(str[:len(str)-1], "type ", "", 1)
-	if docs := f.Type.GetDocs(); docs != "" {
+	if f.Embedded {
+		str = strings.TrimPrefix(str, f.GetName()+" ")
+	}
+	tag += fmtTrailing(f.GetComment())
+	if docs := f.Type.GetDocs() + fmtMarkers(f); docs != "" {
 		return fmt.Sprintf("%s%s %s\n", docs, str, tag)
 	}
 	return fmt.Sprintf("%s %s\n", str, tag)
 }
 
+// withComment adds the trailing comment of t to src, the rendering of its
+// declaration: to the last line, or to the first for an enum, whose values
+// follow it.
+func withComment(t Type, src string) string {
+	comment := fmtTrailing(t.GetComment())
+	if comment == "" {
+		return src
+	}
+	end := len(src) - 1
+	if _, ok := t.(*EnumType); ok {
+		end = strings.Index(src, "\n")
+	}
+	return src[:end] + comment + src[end:]
+}
+
+func fmtTrailing(comment string) string {
+	if comment == "" {
+		return ""
+	}
+	return " " + comment
+}
+
+// fmtTypeSpec renders what follows the name of a type declaration and comes
+// before its type: the type parameters, and "=" for an alias.
+func fmtTypeSpec(tps []*TypeParam, alias bool) string {
+	var spec string
+	if len(tps) > 0 {
+		params := make([]string, len(tps))
+		for i, tp := range tps {
+			params[i] = tp.Name + " " + tp.Constraint.String()
+		}
+		spec = "[" + strings.Join(params, ", ") + "]"
+	}
+	if alias {
+		spec += " ="
+	}
+	return spec
+}
+
+func fmtChan(dir ChanDir, typ string) string {
+	switch dir {
+	case ChanSend:
+		return "chan<- " + typ
+	case ChanRecv:
+		return "<-chan " + typ
+	}
+	return "chan " + typ
+}
+
+func fmtSignature(params, results []*Param) string {
+	sig := "(" + fmtParams(params) + ")"
+	switch {
+	case len(results) == 1 && results[0].Name == "":
+		sig += " " + results[0].Type.String()
+	case len(results) > 0:
+		sig += " (" + fmtParams(results) + ")"
+	}
+	return sig
+}
+
+func fmtParams(params []*Param) string {
+	strs := make([]string, len(params))
+	for i, p := range params {
+		str := p.Type.String()
+		if p.Variadic {
+			str = "..." + str
+		}
+		if p.Name != "" {
+			str = p.Name + " " + str
+		}
+		strs[i] = str
+	}
+	return strings.Join(strs, ", ")
+}
+
 func goFormat(src []byte) []byte {
 	formatted, err := imports.Process("", src, nil)
 	if err != nil {
@@ -17,39 +17,39 @@ var file = File{
 	Code: []Type{
 		&PlainType{
 			Name: "myint",
-			Type: "int",
+			Type: ParseTypeRef("int"),
 		},
 		&PlainType{
 			Docs: "// a string\n",
 			Name: "mystr",
-			Type: "string",
+			Type: ParseTypeRef("string"),
 		},
 		&PlainType{
 			Docs: "// multi-line\n// comment\n",
 			Name: "myinterface",
-			Type: "interface{}",
+			Type: ParseTypeRef("interface{}"),
 		},
 		&PlainType{
 			Docs: "/* another multi-line\n comment */\n",
 			Name: "mystr",
-			Type: "string",
+			Type: ParseTypeRef("string"),
 		},
 		&ArrayType{
 			Docs: "// a slice\n",
 			Name: "myslice",
-			Type: "int",
+			Type: ParseTypeRef("int"),
 		},
 		&ArrayType{
 			Docs:   "// a fixed-length array\n",
 			Name:   "myarr",
-			Type:   "int",
+			Type:   ParseTypeRef("int"),
 			Length: 5,
 		},
 		&MapType{
 			Docs:      "// a string map\n",
 			Name:      "mymap",
-			KeyType:   "string",
-			ValueType: "int64",
+			KeyType:   ParseTypeRef("string"),
+			ValueType: ParseTypeRef("int64"),
 		},
 		&StructType{
 			Docs: "// a struct\n",
@@ -59,7 +59,7 @@ var file = File{
 					Type: &PlainType{
 						Docs: "// field1\n",
 						Name: "Field1",
-						Type: "int32",
+						Type: ParseTypeRef("int32"),
 					},
 					Tags: tagsMustParse(`json:"field1"`),
 				},
@@ -67,7 +67,7 @@ var file = File{
 					Type: &ArrayType{
 						Docs: "// field2\n",
 						Name: "Field2",
-						Type: "bool",
+						Type: ParseTypeRef("bool"),
 					},
 					Tags: tagsMustParse(`json:"field2"`),
 				},
@@ -75,8 +75,8 @@ var file = File{
 					Type: &MapType{
 						Docs:      "// field3\n",
 						Name:      "Field3",
-						KeyType:   "int",
-						ValueType: "struct{}",
+						KeyType:   ParseTypeRef("int"),
+						ValueType: ParseTypeRef("struct{}"),
 					},
 					Tags: tagsMustParse(`json:"field3"`),
 				},
@@ -89,7 +89,7 @@ var file = File{
 								Type: &PlainType{
 									Docs: "nestedfield",
 									Name: "NestedField",
-									Type: "int64",
+									Type: ParseTypeRef("int64"),
 								},
 								Tags: tagsMustParse(`json:"nestedField"`),
 							},
@@ -101,7 +101,7 @@ var file = File{
 		},
 		&EnumType{
 			Name:   "MyEnum",
-			Values: []string{"MyEnum_A", "MyEnum_B", "MyEnum_C"},
+			Values: []*EnumValue{{Name: "MyEnum_A"}, {Name: "MyEnum_B"}, {Name: "MyEnum_C"}},
 		},
 	},
 }
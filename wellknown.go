@@ -0,0 +1,93 @@
+package toast
+
+// WellKnownType is a protobuf well-known type, which protojson encodes in a
+// canonical JSON form of its own rather than as a message.
+type WellKnownType struct {
+	// Format names the JSON form, e.g. "duration" for a string such as
+	// "1.5s", for emitters of other schemas.
+	Format string
+	// CUE is the CUE expression for the JSON form.
+	CUE string
+}
+
+// WellKnownTypes are the protobuf well-known types, by import path and name,
+// e.g. "google.golang.org/protobuf/types/known/durationpb.Duration". The
+// packages of the older github.com/golang/protobuf module are included.
+var WellKnownTypes = map[string]WellKnownType{}
+
+func init() {
+	for pkg, types := range map[string]map[string]WellKnownType{
+		"durationpb": {
+			"Duration": {Format: "duration", CUE: `=~"^-?[0-9]+(\\.[0-9]+)?s$"`},
+		},
+		"timestamppb": {
+			"Timestamp": {Format: "timestamp", CUE: "time.Time"},
+		},
+		"structpb": {
+			"Struct":    {Format: "struct", CUE: "{...}"},
+			"Value":     {Format: "value", CUE: "_"},
+			"ListValue": {Format: "list", CUE: "[..._]"},
+			"NullValue": {Format: "null", CUE: "null"},
+		},
+		"anypb": {
+			"Any": {Format: "any", CUE: `{"@type": string, ...}`},
+		},
+		"emptypb": {
+			"Empty": {Format: "empty", CUE: "close({})"},
+		},
+		"fieldmaskpb": {
+			"FieldMask": {Format: "field-mask", CUE: "string"},
+		},
+		"wrapperspb": {
+			"DoubleValue": {Format: "wrapper", CUE: "null | float64"},
+			"FloatValue":  {Format: "wrapper", CUE: "null | float32"},
+			"Int64Value":  {Format: "wrapper", CUE: "null | int64"},
+			"UInt64Value": {Format: "wrapper", CUE: "null | uint64"},
+			"Int32Value":  {Format: "wrapper", CUE: "null | int32"},
+			"UInt32Value": {Format: "wrapper", CUE: "null | uint32"},
+			"BoolValue":   {Format: "wrapper", CUE: "null | bool"},
+			"StringValue": {Format: "wrapper", CUE: "null | string"},
+			"BytesValue":  {Format: "wrapper", CUE: "null | bytes"},
+		},
+	} {
+		for name, wkt := range types {
+			WellKnownTypes["google.golang.org/protobuf/types/known/"+pkg+"."+name] = wkt
+			if old, ok := legacyWellKnownPackages[pkg]; ok {
+				WellKnownTypes["github.com/golang/protobuf/ptypes/"+old+"."+name] = wkt
+			}
+		}
+	}
+}
+
+// legacyWellKnownPackages are the github.com/golang/protobuf/ptypes packages
+// that alias the well-known types, by the name of the current package.
+var legacyWellKnownPackages = map[string]string{
+	"durationpb":  "duration",
+	"timestamppb": "timestamp",
+	"structpb":    "struct",
+	"anypb":       "any",
+	"emptypb":     "empty",
+	"wrapperspb":  "wrappers",
+}
+
+// resolveWellKnown sets the import path and JSON form of each reference in
+// code to a protobuf well-known type.
+func (f *File) resolveWellKnown(code []Type) {
+	for _, t := range code {
+		for _, ref := range t.GetTypeRefs() {
+			ref.Walk(func(r *TypeRef) bool {
+				if r.Kind != RefNamed || r.Package == "" {
+					return true
+				}
+				path := r.Path
+				if imp, ok := f.Imports[r.Package]; ok && path == "" {
+					path = imp.GetOldPath()
+				}
+				if wkt, ok := WellKnownTypes[path+"."+r.Name]; ok && path != "" {
+					r.Path, r.WellKnown = path, wkt.Format
+				}
+				return true
+			})
+		}
+	}
+}